@@ -0,0 +1,509 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"lambdactl/pkg/api"
+	"lambdactl/pkg/config"
+	"lambdactl/pkg/output"
+	"lambdactl/pkg/secrets"
+
+	"github.com/charmbracelet/huh"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+// Where config init saves the API key
+const (
+	keyInConfig  = "config"
+	keyInKeyring = "keyring"
+)
+
+var configCmd = &cobra.Command{
+	Use:         "config",
+	Short:       "Manage lambdactl configuration",
+	Annotations: map[string]string{skipConfigCheck: "true"},
+}
+
+var configListProfilesCmd = &cobra.Command{
+	Use:   "list-profiles",
+	Short: "List configured profiles, marking the active one",
+	Args:  cobra.NoArgs,
+	RunE:  configListProfilesFunc,
+}
+
+var configUseProfileCmd = &cobra.Command{
+	Use:   "use-profile <name>",
+	Short: "Make a profile the default",
+	Args:  cobra.ExactArgs(1),
+	RunE:  configUseProfileFunc,
+}
+
+var configInitCmd = &cobra.Command{
+	Use:   "init",
+	Short: "Interactively set up the API key and SSH defaults",
+	Long:  "Interactively set up the API key and SSH defaults, checking the key against the API before saving. With --profile the answers go into that profile.",
+	Args:  cobra.NoArgs,
+	RunE:  configInitFunc,
+}
+
+var configGetCmd = &cobra.Command{
+	Use:   "get <key>",
+	Short: "Print the effective value of a key",
+	Args:  cobra.ExactArgs(1),
+	RunE:  configGetFunc,
+}
+
+var configSetCmd = &cobra.Command{
+	Use:   "set <key> <value>",
+	Short: "Set a key in the config file, or in a profile with --profile",
+	Long:  "Set a key in the config file, or in a profile with --profile. Lists like ssh-key-names are comma-separated.",
+	Args:  cobra.ExactArgs(2),
+	RunE:  configSetFunc,
+}
+
+var configViewCmd = &cobra.Command{
+	Use:   "view",
+	Short: "Show the effective configuration with secrets redacted",
+	Args:  cobra.NoArgs,
+	RunE:  configViewFunc,
+}
+
+var configValidateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Check the configuration for unknown keys and bad values",
+	Args:  cobra.NoArgs,
+	RunE:  configValidateFunc,
+}
+
+func configInitFunc(cmd *cobra.Command, args []string) error {
+	// Start from what's configured, so re-running init edits rather than resets
+	apiURL := viper.GetString("api-url")
+	apiKey := viper.GetString("api-key")
+	sshUser := viper.GetString("ssh-user")
+	sshKeyFile := viper.GetString("ssh-key-file")
+	region := viper.GetString("region")
+	sshKeyNames := viper.GetStringSlice("ssh-key-names")
+	keyStorage := keyInConfig
+	if viper.GetString("api-key-keyring") != "" {
+		keyStorage = keyInKeyring
+	}
+
+	err := huh.NewForm(huh.NewGroup(
+		huh.NewInput().
+			Title("API URL").
+			Value(&apiURL).
+			Validate(validateConfigValue("api-url")),
+		huh.NewInput().
+			Title("API key").
+			Description("Create one at https://cloud.lambdalabs.com/api-keys").
+			EchoMode(huh.EchoModePassword).
+			Value(&apiKey).
+			Validate(func(s string) error {
+				if strings.TrimSpace(s) == "" {
+					return errors.New("API key is required")
+				}
+				return nil
+			}),
+		huh.NewSelect[string]().
+			Title("Save the API key in").
+			Options(
+				huh.NewOption("Config file", keyInConfig),
+				huh.NewOption("OS keyring (or ~/.lambda-keyring.yaml without one)", keyInKeyring),
+			).
+			Value(&keyStorage),
+	)).Run()
+	if err != nil {
+		return err
+	}
+	apiKey = strings.TrimSpace(apiKey)
+
+	// Check the key works before saving it
+	client, err := api.NewAPIClient(apiURL, apiKey, api.ConfigOptions()...)
+	if err != nil {
+		return err
+	}
+	accountKeys, err := client.ListSSHKeys(cmd.Context())
+	if err != nil {
+		return fmt.Errorf("API key check failed: %w", err)
+	}
+	fmt.Fprintln(os.Stderr, "API key is valid")
+
+	fields := []huh.Field{
+		huh.NewInput().
+			Title("Default region").
+			Description("Optional, e.g. us-east-1").
+			Value(&region),
+		huh.NewInput().
+			Title("SSH user").
+			Value(&sshUser),
+		huh.NewInput().
+			Title("SSH private key").
+			Description("Absolute or relative to ~/.ssh").
+			Value(&sshKeyFile),
+	}
+	if len(accountKeys) > 0 {
+		var names []string
+		for _, key := range accountKeys {
+			names = append(names, key.Name)
+		}
+		fields = append(fields, huh.NewMultiSelect[string]().
+			Title("SSH keys to add to launched instances").
+			Options(huh.NewOptions(names...)...).
+			Value(&sshKeyNames))
+	}
+	if err := huh.NewForm(huh.NewGroup(fields...)).Run(); err != nil {
+		return err
+	}
+
+	values := []struct {
+		key   string
+		value any
+	}{
+		{"api-url", apiURL},
+		{"ssh-user", sshUser},
+		{"ssh-key-file", sshKeyFile},
+		{"region", region},
+		{"ssh-key-names", sshKeyNames},
+	}
+	for _, v := range values {
+		// Leave optional keys out rather than writing empty values
+		if (v.key == "region" && region == "") || (v.key == "ssh-key-names" && len(sshKeyNames) == 0) {
+			continue
+		}
+		if err := writeConfigValue(configKeyPath(v.key), v.value); err != nil {
+			return err
+		}
+	}
+
+	if err := saveAPIKey(apiKey, keyStorage); err != nil {
+		return err
+	}
+
+	path, _ := configFilePath()
+	fmt.Printf("Wrote %s\n", path)
+	return nil
+}
+
+// Store the key where asked, dropping the other copy so only one source is left
+func saveAPIKey(apiKey, storage string) error {
+	if storage == keyInConfig {
+		if err := writeConfigValue(configKeyPath("api-key"), apiKey); err != nil {
+			return err
+		}
+		return removeConfigValue(configKeyPath("api-key-keyring"))
+	}
+
+	account := profileName
+	if account == "" {
+		account = "default"
+	}
+
+	keyring, err := secrets.OpenKeyring(viper.GetString("keyring-backend"))
+	if err != nil {
+		return err
+	}
+	if err := keyring.Set(account, apiKey); err != nil {
+		return err
+	}
+
+	if err := writeConfigValue(configKeyPath("api-key-keyring"), account); err != nil {
+		return err
+	}
+	return removeConfigValue(configKeyPath("api-key"))
+}
+
+func configGetFunc(cmd *cobra.Command, args []string) error {
+	reveal, _ := cmd.Flags().GetBool("reveal")
+
+	key, ok := config.Lookup(args[0])
+	if !ok {
+		return fmt.Errorf("unknown key %q", args[0])
+	}
+	if !viper.IsSet(key.Name) {
+		return fmt.Errorf("%s is not set", key.Name)
+	}
+
+	var value any = viper.GetString(key.Name)
+	if key.Kind == config.StringListKind {
+		value = strings.Join(viper.GetStringSlice(key.Name), ",")
+	}
+	if !reveal {
+		value = key.Redact(value)
+	}
+	fmt.Println(value)
+	return nil
+}
+
+func configSetFunc(cmd *cobra.Command, args []string) error {
+	path := configKeyPath(args[0])
+
+	key, ok := config.Lookup(path)
+	if !ok {
+		if profileName != "" {
+			return fmt.Errorf("unknown key %q, or it can't be set per profile", args[0])
+		}
+		return fmt.Errorf("unknown key %q", args[0])
+	}
+
+	value, err := key.Parse(args[1])
+	if err != nil {
+		return err
+	}
+	return writeConfigValue(key.Name, value)
+}
+
+func configViewFunc(cmd *cobra.Command, args []string) error {
+	reveal, _ := cmd.Flags().GetBool("reveal")
+
+	format, err := outputFormat(cmd, output.YAMLKind)
+	if err != nil {
+		return err
+	}
+
+	settings := viper.AllSettings()
+	if !reveal {
+		settings = config.Redact(settings)
+	}
+	if err := output.Print(os.Stdout, format, settings, nil); err != nil {
+		return err
+	}
+
+	// Still show what's there, then what's wrong with it
+	return configErr
+}
+
+func configValidateFunc(cmd *cobra.Command, args []string) error {
+	if configErr != nil {
+		return configErr
+	}
+	if err := checkRequiredConfig(); err != nil {
+		return err
+	}
+
+	path, _ := configFilePath()
+	fmt.Printf("%s is valid\n", path)
+	return nil
+}
+
+// Key in the --profile profile when one was given, else at the top level
+func configKeyPath(key string) string {
+	if profileName != "" {
+		return config.ProfilesKey + "." + profileName + "." + key
+	}
+	return key
+}
+
+func validateConfigValue(name string) func(string) error {
+	key, _ := config.Lookup(name)
+	return func(value string) error {
+		_, err := key.Parse(value)
+		return err
+	}
+}
+
+func configListProfilesFunc(cmd *cobra.Command, args []string) error {
+	active := activeProfile()
+	for _, name := range profileNames() {
+		marker := " "
+		if name == active {
+			marker = "*"
+		}
+		fmt.Printf("%s %s\n", marker, name)
+	}
+	return nil
+}
+
+func configUseProfileFunc(cmd *cobra.Command, args []string) error {
+	name := args[0]
+	if !viper.IsSet("profiles." + name) {
+		return fmt.Errorf("unknown profile %q, have %v", name, profileNames())
+	}
+
+	if err := writeConfigValue("profile", name); err != nil {
+		return err
+	}
+
+	if os.Getenv("LAMBDA_PROFILE") != "" {
+		fmt.Fprintln(os.Stderr, "Note: LAMBDA_PROFILE is set and overrides the default profile")
+	}
+	fmt.Printf("Using profile %s\n", name)
+	return nil
+}
+
+// Config file in use, or where a new one should go
+func configFilePath() (string, error) {
+	if path := viper.ConfigFileUsed(); path != "" {
+		return path, nil
+	}
+	if cfgFile != "" {
+		return cfgFile, nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".lambda.yaml"), nil
+}
+
+// Set a dotted key in the config file itself. Edits the YAML tree rather than
+// viper's merged view, so comments, other profiles and env values stay put.
+func writeConfigValue(key string, value any) error {
+	path, err := configFilePath()
+	if err != nil {
+		return err
+	}
+
+	doc, err := loadConfigDocument(path)
+	if err != nil {
+		return err
+	}
+
+	node := doc.Content[0]
+	for _, part := range strings.Split(key, ".") {
+		node, err = mappingChild(node, part)
+		if err != nil {
+			return fmt.Errorf("failed to set %s: %v", key, err)
+		}
+	}
+	if err := node.Encode(value); err != nil {
+		return fmt.Errorf("failed to set %s: %v", key, err)
+	}
+
+	return saveConfigDocument(path, doc)
+}
+
+// Delete a dotted key from the config file, if it's there
+func removeConfigValue(key string) error {
+	path, err := configFilePath()
+	if err != nil {
+		return err
+	}
+
+	doc, err := loadConfigDocument(path)
+	if err != nil {
+		return err
+	}
+
+	parts := strings.Split(key, ".")
+	node := doc.Content[0]
+	for _, part := range parts[:len(parts)-1] {
+		if node = lookupChild(node, part); node == nil {
+			return nil
+		}
+	}
+
+	if node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == parts[len(parts)-1] {
+			node.Content = append(node.Content[:i], node.Content[i+2:]...)
+			return saveConfigDocument(path, doc)
+		}
+	}
+	return nil
+}
+
+func loadConfigDocument(path string) (*yaml.Node, error) {
+	doc := &yaml.Node{Kind: yaml.DocumentNode}
+
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read config file: %v", err)
+	}
+	if err := yaml.Unmarshal(data, doc); err != nil {
+		return nil, fmt.Errorf("failed to parse config file: %v", err)
+	}
+
+	// Empty or missing file
+	if len(doc.Content) == 0 {
+		doc.Kind = yaml.DocumentNode
+		doc.Content = []*yaml.Node{{Kind: yaml.MappingNode}}
+	}
+	if doc.Content[0].Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("config file %s is not a YAML mapping", path)
+	}
+	return doc, nil
+}
+
+// Value node for key in a mapping, or nil
+func lookupChild(node *yaml.Node, key string) *yaml.Node {
+	if node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// Value node for key in a mapping, added if missing
+func mappingChild(node *yaml.Node, key string) (*yaml.Node, error) {
+	if node.Kind == yaml.ScalarNode && node.Tag == "!!null" {
+		*node = yaml.Node{Kind: yaml.MappingNode}
+	}
+	if node.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("%q is inside a non-mapping value", key)
+	}
+
+	if child := lookupChild(node, key); child != nil {
+		return child, nil
+	}
+
+	value := &yaml.Node{Kind: yaml.MappingNode}
+	node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: key}, value)
+	return value, nil
+}
+
+// Replace the config file atomically, it holds secrets so keep it 0600
+func saveConfigDocument(path string, doc *yaml.Node) error {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(doc); err != nil {
+		return fmt.Errorf("failed to marshal config: %v", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".lambda-*")
+	if err != nil {
+		return fmt.Errorf("failed to write config file: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write config file: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write config file: %v", err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to write config file: %v", err)
+	}
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(configCmd)
+	configCmd.AddCommand(configInitCmd)
+	configCmd.AddCommand(configGetCmd)
+	configCmd.AddCommand(configSetCmd)
+	configCmd.AddCommand(configViewCmd)
+	configCmd.AddCommand(configValidateCmd)
+	configCmd.AddCommand(configListProfilesCmd)
+	configCmd.AddCommand(configUseProfileCmd)
+
+	configGetCmd.Flags().Bool("reveal", false, "Print secrets instead of redacting them")
+	configViewCmd.Flags().Bool("reveal", false, "Print secrets instead of redacting them")
+}
@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"os"
 	"strings"
@@ -33,12 +34,11 @@ type RKE2TemplateData struct {
 
 func init() {
 	rootCmd.AddCommand(deployCmd)
-	deployCmd.Flags().String("host", "", "Target host")
-	deployCmd.Flags().Int("port", 22, "SSH port")
-	deployCmd.Flags().String("user", "ubuntu", "SSH user")
+	deployCmd.Flags().String("host", "", "Target host or ~/.ssh/config alias")
 	deployCmd.Flags().Bool("root", false, "Switch to root for deployment")
 	deployCmd.Flags().String("role", "worker", "Node role")
 	deployCmd.Flags().String("version", "", "Deployment version")
+	addSSHFlags(deployCmd)
 	deployCmd.MarkFlagRequired("host")
 }
 
@@ -51,23 +51,23 @@ var deployCmd = &cobra.Command{
 
 		// Flags
 		host, _ := cmd.Flags().GetString("host")
-		port, _ := cmd.Flags().GetInt("port")
-		user, _ := cmd.Flags().GetString("user")
 		root, _ := cmd.Flags().GetBool("root")
 		nodeRole, _ := cmd.Flags().GetString("role")
 		deployVersion, _ := cmd.Flags().GetString("version")
 
-		// Skip escalation step if already root
-		if user == "root" {
-			root = false
+		// Create SSHTarget based on user input
+		target, err := sshTargetFromFlags(cmd, host)
+		if err != nil {
+			log.Fatalf("Invalid SSH flags: %v", err)
+		}
+		// Still honoured from before ssh-key-file existed
+		if keyName := os.Getenv("SSH_KEY_NAME"); keyName != "" && target.KeyName == "" {
+			target.KeyName = keyName
 		}
 
-		// Create SSHTarget based on user input
-		target := sshlib.SSHTarget{
-			Host:    host,
-			KeyName: os.Getenv("SSH_KEY_NAME"), // You might load this from config (e.g., Viper)
-			Port:    port,
-			User:    user,
+		// Skip escalation step if already root
+		if target.User == "root" {
+			root = false
 		}
 
 		// Create SSH client
@@ -77,6 +77,8 @@ var deployCmd = &cobra.Command{
 		}
 		defer client.Client.Close()
 
+		ctx := cmd.Context()
+
 		// Enable root access if requested
 		if root {
 			if err := enableRootAccess(client); err != nil {
@@ -102,12 +104,12 @@ var deployCmd = &cobra.Command{
 		switch strings.ToLower(deploymentType) {
 		case kubernetesType:
 			// Part 1: Prepare the machine
-			if err := prepareMachine(client); err != nil {
+			if err := prepareMachine(ctx, client); err != nil {
 				log.Fatalf("Failed to prepare machine: %v", err)
 			}
 
 			// Part 2: Set up RKE2 (Kubernetes)
-			if err := deployKubernetes(client, sftpClient, target.Host, nodeRole, deployVersion); err != nil {
+			if err := deployKubernetes(ctx, client, sftpClient, target.Host, nodeRole, deployVersion); err != nil {
 				log.Fatalf("Failed to deploy Kubernetes: %v", err)
 			}
 		}
@@ -129,21 +131,27 @@ func enableRootAccess(c *sshlib.SSHClient) error {
 }
 
 // Part 1: Prepare the machine (remove packages, stop services, install tools)
-func prepareMachine(c *sshlib.SSHClient) error {
+func prepareMachine(ctx context.Context, c *sshlib.SSHClient) error {
 	log.Info("Preparing the machine...")
 
 	// Steps
 	commands := []string{
-		"DEBIAN_FRONTEND=noninteractive apt-get autoremove --purge -y '~i !~OUbuntu'", // Remove 3rd-party packages
+		"apt-get autoremove --purge -y '~i !~OUbuntu'", // Remove 3rd-party packages
 		// "systemctl stop unwanted-service",           // Stop service
-		"DEBIAN_FRONTEND=noninteractive apt-get update",     // Update repos
-		"DEBIAN_FRONTEND=noninteractive apt-get upgrade -y", // Upgrade machine
+		"apt-get update",     // Update repos
+		"apt-get upgrade -y", // Upgrade machine
+	}
+	opts := sshlib.ExecOptions{
+		Env:    map[string]string{"DEBIAN_FRONTEND": "noninteractive"},
+		Stdout: os.Stdout,
+		Stderr: os.Stderr,
+		Prefix: "  ",
 	}
 
 	for _, cmd := range commands {
 
 		log.Debugf("Running: %s\n", cmd)
-		if err := c.Run(cmd); err != nil {
+		if _, err := c.Exec(ctx, cmd, opts); err != nil {
 			return fmt.Errorf("failed to run command '%s': %v", cmd, err)
 		}
 	}
@@ -152,7 +160,7 @@ func prepareMachine(c *sshlib.SSHClient) error {
 }
 
 // Part 2: Set up RKE2 (Kubernetes)
-func deployKubernetes(c *sshlib.SSHClient, s *sshlib.SFTPClient, publicIP string, nodeRole string, deployVersion string) error {
+func deployKubernetes(ctx context.Context, c *sshlib.SSHClient, s *sshlib.SFTPClient, publicIP string, nodeRole string, deployVersion string) error {
 	log.Info("Setting up RKE2 (Kubernetes)...")
 
 	var rke2Role string
@@ -166,8 +174,14 @@ func deployKubernetes(c *sshlib.SSHClient, s *sshlib.SFTPClient, publicIP string
 	}
 
 	// Step 1: Download and install RKE2 installer
-	installerCmd := fmt.Sprintf("curl -sfL https://get.rke2.io | INSTALL_RKE2_TYPE=%s INSTALL_RKE2_VERSION=%s sh -", rke2Role, deployVersion)
-	if err := c.Run(installerCmd); err != nil {
+	installerCmd := "curl -sfL https://get.rke2.io | sh -"
+	opts := sshlib.ExecOptions{
+		Env:    map[string]string{"INSTALL_RKE2_TYPE": rke2Role, "INSTALL_RKE2_VERSION": deployVersion},
+		Stdout: os.Stdout,
+		Stderr: os.Stderr,
+		Prefix: "  ",
+	}
+	if _, err := c.Exec(ctx, installerCmd, opts); err != nil {
 		return fmt.Errorf("failed to install RKE2: %v", err)
 	}
 
@@ -227,7 +241,7 @@ func deployKubernetes(c *sshlib.SSHClient, s *sshlib.SFTPClient, publicIP string
 
 	// Step 4: Start the RKE2 service
 	startServiceCmd := "systemctl enable --now --no-block rke2-server"
-	if err := c.Run(startServiceCmd); err != nil {
+	if _, err := c.Exec(ctx, startServiceCmd, sshlib.ExecOptions{Stdout: os.Stdout, Stderr: os.Stderr}); err != nil {
 		return fmt.Errorf("failed to start RKE2: %v", err)
 	}
 
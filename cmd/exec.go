@@ -0,0 +1,260 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"lambdactl/pkg/api"
+	"lambdactl/pkg/filter"
+	"lambdactl/pkg/output"
+	"lambdactl/pkg/sshlib"
+
+	"github.com/spf13/cobra"
+)
+
+var execCmd = &cobra.Command{
+	Use:   "exec [id|name]... -- command",
+	Short: "Run a command on instances by ID, name, filter or --all",
+	Example: `  lambdactl exec --all nvidia-smi
+  lambdactl exec -f name~train-* -- df -h /home
+  lambdactl exec train-1 train-2 -o json -- 'journalctl -u rke2-agent -n 20'`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: execFunc,
+}
+
+// How the command went on one instance
+type execResult struct {
+	ID         string `json:"id" yaml:"ID"`
+	Name       string `json:"name" yaml:"Name"`
+	IP         string `json:"ip" yaml:"IP"`
+	ExitStatus int    `json:"exit_status" yaml:"ExitStatus"`
+	Duration   string `json:"duration" yaml:"Duration"`
+	Stdout     string `json:"stdout,omitempty" yaml:"Stdout,omitempty"`
+	Stderr     string `json:"stderr,omitempty" yaml:"Stderr,omitempty"`
+	Error      string `json:"error,omitempty" yaml:"Error,omitempty"`
+
+	label string // The instance's Label, for the table
+}
+
+var execTable = output.Table[execResult]{
+	Columns: []output.Column[execResult]{
+		{Header: "NAME", Value: func(r execResult) string { return r.label }},
+		{Header: "IP", Value: func(r execResult) string { return r.IP }},
+		{Header: "EXIT", Value: func(r execResult) string { return fmt.Sprint(r.ExitStatus) }},
+		{Header: "DURATION", Value: func(r execResult) string { return r.Duration }},
+		{Header: "ERROR", Value: func(r execResult) string { return r.Error }},
+		{Header: "ID", Wide: true, Value: func(r execResult) string { return r.ID }},
+	},
+	Name: func(r execResult) string { return r.label },
+}
+
+func execFunc(cmd *cobra.Command, args []string) error {
+	all, _ := cmd.Flags().GetBool("all")
+	parallel, _ := cmd.Flags().GetInt("parallel")
+	timeout, _ := cmd.Flags().GetDuration("timeout")
+
+	format, err := outputFormat(cmd, output.TableKind)
+	if err != nil {
+		return err
+	}
+
+	// Everything after -- is the command, without it only the last argument is
+	refs, command := args[:len(args)-1], args[len(args)-1]
+	if dash := cmd.ArgsLenAtDash(); dash >= 0 {
+		refs, command = args[:dash], strings.Join(args[dash:], " ")
+	}
+	if strings.TrimSpace(command) == "" {
+		return errors.New("no command given, e.g. lambdactl exec --all -- nvidia-smi")
+	}
+	if all && len(refs) > 0 {
+		return errors.New("--all can't be combined with instance IDs or names")
+	}
+
+	f, err := filterFromFlags(cmd, api.IsInstanceField)
+	if err != nil {
+		return err
+	}
+	if !all && len(refs) == 0 && len(f) == 0 {
+		return errors.New("specify instances by ID or name, select them with --filter, or use --all")
+	}
+
+	target, err := sshTargetFromFlags(cmd, "")
+	if err != nil {
+		return err
+	}
+
+	client, err := newAPIClient(cmd.Context())
+	if err != nil {
+		return err
+	}
+
+	listed, err := listInstances(cmd.Context(), client)
+	if err != nil {
+		return err
+	}
+
+	var instances []api.InstanceDetails
+	if all {
+		instances, err = activeInstances(listed, f)
+	} else {
+		instances, err = selectFrom(listed, refs, f, len(f) > 0)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := pruneReleasedHosts(listed); err != nil {
+		return err
+	}
+
+	// Captured output goes in the results for machine-readable formats,
+	// tables get it streamed as it arrives
+	stream := format.Kind == output.TableKind || format.Kind == output.WideKind
+	results := execInstances(cmd.Context(), instances, command, execOptions{
+		target:   target,
+		parallel: parallel,
+		timeout:  timeout,
+		stream:   stream,
+	})
+
+	if stream {
+		fmt.Println()
+	}
+	if err := output.PrintList(os.Stdout, format, results, execTable); err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, result := range results {
+		if result.ExitStatus != 0 {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("command failed on %d of %d instance(s)", failed, len(results))
+	}
+	return nil
+}
+
+// Every active instance, narrowed by f
+func activeInstances(instances []api.InstanceDetails, f filter.Filter) ([]api.InstanceDetails, error) {
+	var active []api.InstanceDetails
+	for _, instance := range filter.Apply(f, instances) {
+		if instance.Status == api.StatusActive {
+			active = append(active, instance)
+		}
+	}
+	if len(active) == 0 {
+		return nil, errors.New("no active instances match")
+	}
+	return active, nil
+}
+
+type execOptions struct {
+	target   sshlib.SSHTarget
+	parallel int
+	timeout  time.Duration
+	stream   bool
+}
+
+// Run command on every instance, a few at a time, results in instance order
+func execInstances(ctx context.Context, instances []api.InstanceDetails, command string, opts execOptions) []execResult {
+	// Pad prefixes to the longest label so streamed output lines up
+	width := 0
+	for _, instance := range instances {
+		width = max(width, len(instance.Label()))
+	}
+
+	results := make([]execResult, len(instances))
+	sem := make(chan struct{}, max(opts.parallel, 1))
+	var wg sync.WaitGroup
+	for i, instance := range instances {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			prefix := fmt.Sprintf("%-*s | ", width, instance.Label())
+			results[i] = execInstance(ctx, instance, command, prefix, opts)
+		}()
+	}
+	wg.Wait()
+
+	return results
+}
+
+func execInstance(ctx context.Context, instance api.InstanceDetails, command, prefix string, opts execOptions) (result execResult) {
+	result = execResult{
+		ID:         instance.ID,
+		Name:       instance.Name,
+		IP:         instance.IP,
+		ExitStatus: -1,
+		label:      instance.Label(),
+	}
+
+	// Named instances may not be up yet
+	if instance.Status != api.StatusActive || instance.IP == "" {
+		result.Error = fmt.Sprintf("instance is %s", instance.Status)
+		return result
+	}
+
+	// Interrupted while waiting for a slot
+	if ctx.Err() != nil {
+		result.Error = ctx.Err().Error()
+		return result
+	}
+
+	start := time.Now()
+	defer func() {
+		result.Duration = time.Since(start).Round(time.Millisecond).String()
+	}()
+
+	target := opts.target
+	target.Host = instance.IP
+	client, err := sshlib.NewSSHClient(target)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	defer client.Client.Close()
+
+	if opts.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.timeout)
+		defer cancel()
+	}
+
+	execOpts := sshlib.ExecOptions{}
+	if opts.stream {
+		execOpts = sshlib.ExecOptions{Stdout: os.Stdout, Stderr: os.Stderr, Prefix: prefix}
+	}
+
+	out, err := client.Exec(ctx, command, execOpts)
+	if out != nil {
+		result.ExitStatus = out.ExitStatus
+		if !opts.stream {
+			result.Stdout = string(out.Stdout)
+			result.Stderr = string(out.Stderr)
+		}
+	}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	return result
+}
+
+func init() {
+	rootCmd.AddCommand(execCmd)
+
+	execCmd.Flags().Bool("all", false, "Run on every active instance, or every active one matching --filter")
+	execCmd.Flags().Int("parallel", 8, "Instances to run on at once")
+	execCmd.Flags().Duration("timeout", 0, "Give up on an instance after this long, 0 waits forever")
+	addFilterFlag(execCmd)
+	addSSHFlags(execCmd)
+}
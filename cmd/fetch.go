@@ -2,37 +2,61 @@ package cmd
 
 import (
 	"fmt"
+	"os"
 
 	"lambdactl/pkg/api"
+	"lambdactl/pkg/filter"
+	"lambdactl/pkg/output"
 
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
-	"gopkg.in/yaml.v3"
 )
 
 var fetchCmd = &cobra.Command{
 	Use:   "fetch",
 	Short: "Fetch instance types available to launch",
-	Run:   fetchFunc,
+	RunE:  fetchFunc,
 }
 
-func fetchFunc(cmd *cobra.Command, args []string) {
-	client := api.NewAPIClient(viper.GetString("apiUrl"), viper.GetString("apiKey"))
+var optionTable = output.Table[api.InstanceOption]{
+	Columns: []output.Column[api.InstanceOption]{
+		{Header: "TYPE", Value: func(o api.InstanceOption) string { return o.Type.Name }},
+		{Header: "REGION", Value: func(o api.InstanceOption) string { return o.Region }},
+		{Header: "GPUS", Value: func(o api.InstanceOption) string { return fmt.Sprint(o.Type.Specs.GPUs) }},
+		{Header: "$/HOUR", Value: func(o api.InstanceOption) string { return dollars(o.Type.PriceCentsPerHour) }},
+		{Header: "GPU", Wide: true, Value: func(o api.InstanceOption) string { return o.Type.GPUDescription }},
+		{Header: "VCPUS", Wide: true, Value: func(o api.InstanceOption) string { return fmt.Sprint(o.Type.Specs.VCPUs) }},
+		{Header: "MEMORY", Wide: true, Value: func(o api.InstanceOption) string { return fmt.Sprintf("%d GiB", o.Type.Specs.MemoryGiB) }},
+		{Header: "STORAGE", Wide: true, Value: func(o api.InstanceOption) string { return fmt.Sprintf("%d GiB", o.Type.Specs.StorageGiB) }},
+	},
+	Name: func(o api.InstanceOption) string { return o.Type.Name },
+}
 
-	instanceOptions, err := client.FetchInstanceOptions()
+func fetchFunc(cmd *cobra.Command, args []string) error {
+	format, err := outputFormat(cmd, output.YAMLKind)
 	if err != nil {
-		fmt.Printf("error fetching instance options: %v", err)
-		return
+		return err
 	}
 
-	output, err := yaml.Marshal(instanceOptions)
+	f, err := filterFromFlags(cmd, api.IsOptionField)
 	if err != nil {
-		fmt.Printf("error marshalling instance options: %v", err)
-		return
+		return err
 	}
-	fmt.Println(string(output))
+
+	client, err := newAPIClient(cmd.Context())
+	if err != nil {
+		return fmt.Errorf("error creating API client: %v", err)
+	}
+
+	instanceOptions, err := client.FetchInstanceOptions(cmd.Context())
+	if err != nil {
+		return fmt.Errorf("error fetching instance options: %w", err)
+	}
+
+	return output.PrintList(os.Stdout, format, filter.Apply(f, instanceOptions), optionTable)
 }
 
 func init() {
 	rootCmd.AddCommand(fetchCmd)
+
+	addFilterFlag(fetchCmd)
 }
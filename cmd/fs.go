@@ -0,0 +1,155 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"lambdactl/pkg/api"
+	"lambdactl/pkg/output"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var fsCmd = &cobra.Command{
+	Use:   "fs",
+	Short: "Manage persistent filesystems",
+}
+
+var fsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List filesystems",
+	Args:  cobra.NoArgs,
+	RunE:  fsListFunc,
+}
+
+var fsCreateCmd = &cobra.Command{
+	Use:   "create <name>",
+	Short: "Create a filesystem in a region",
+	Args:  cobra.ExactArgs(1),
+	RunE:  fsCreateFunc,
+}
+
+var fsDeleteCmd = &cobra.Command{
+	Use:   "delete <id|name>",
+	Short: "Delete a filesystem",
+	Args:  cobra.ExactArgs(1),
+	RunE:  fsDeleteFunc,
+}
+
+var filesystemTable = output.Table[api.Filesystem]{
+	Columns: []output.Column[api.Filesystem]{
+		{Header: "NAME", Value: func(f api.Filesystem) string { return f.Name }},
+		{Header: "ID", Value: func(f api.Filesystem) string { return f.ID }},
+		{Header: "REGION", Value: func(f api.Filesystem) string { return f.Region.Name }},
+		{Header: "MOUNT POINT", Value: func(f api.Filesystem) string { return f.MountPoint }},
+		{Header: "IN USE", Value: func(f api.Filesystem) string { return fmt.Sprint(f.IsInUse) }},
+		{Header: "USED", Wide: true, Value: func(f api.Filesystem) string { return fmt.Sprintf("%.1f GiB", float64(f.BytesUsed)/(1<<30)) }},
+		{Header: "CREATED", Wide: true, Value: func(f api.Filesystem) string { return f.Created }},
+		{Header: "CREATED BY", Wide: true, Value: func(f api.Filesystem) string { return f.CreatedBy.Email }},
+	},
+	Name: func(f api.Filesystem) string { return f.Name },
+}
+
+func fsListFunc(cmd *cobra.Command, args []string) error {
+	format, err := outputFormat(cmd, output.YAMLKind)
+	if err != nil {
+		return err
+	}
+
+	client, err := newAPIClient(cmd.Context())
+	if err != nil {
+		return err
+	}
+
+	filesystems, err := client.ListFilesystems(cmd.Context())
+	if err != nil {
+		return err
+	}
+
+	return output.PrintList(os.Stdout, format, filesystems, filesystemTable)
+}
+
+func fsCreateFunc(cmd *cobra.Command, args []string) error {
+	region, _ := cmd.Flags().GetString("region")
+	if region == "" {
+		region = viper.GetString("region")
+	}
+	if region == "" {
+		return errors.New("specify --region or set a default region in the config")
+	}
+
+	client, err := newAPIClient(cmd.Context())
+	if err != nil {
+		return err
+	}
+
+	filesystem, err := client.CreateFilesystem(cmd.Context(), args[0], region)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Created filesystem %s (%s) in %s, mounted at %s\n", filesystem.Name, filesystem.ID, filesystem.Region.Name, filesystem.MountPoint)
+	return nil
+}
+
+func fsDeleteFunc(cmd *cobra.Command, args []string) error {
+	yes, _ := cmd.Flags().GetBool("yes")
+
+	client, err := newAPIClient(cmd.Context())
+	if err != nil {
+		return err
+	}
+
+	filesystem, err := resolveFilesystem(cmd.Context(), client, args[0])
+	if err != nil {
+		return err
+	}
+
+	if filesystem.IsInUse {
+		return fmt.Errorf("filesystem %s is attached to a running instance", filesystem.Name)
+	}
+
+	if !yes {
+		ok, err := confirm(fmt.Sprintf("Delete filesystem %s and all its data?", filesystem.Name), filesystem.ID)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			fmt.Println("Aborted.")
+			return nil
+		}
+	}
+
+	if err := client.DeleteFilesystem(cmd.Context(), filesystem.ID); err != nil {
+		return err
+	}
+
+	fmt.Printf("Deleted filesystem %s (%s)\n", filesystem.Name, filesystem.ID)
+	return nil
+}
+
+func resolveFilesystem(ctx context.Context, client *api.APIClient, idOrName string) (api.Filesystem, error) {
+	filesystems, err := client.ListFilesystems(ctx)
+	if err != nil {
+		return api.Filesystem{}, err
+	}
+
+	for _, filesystem := range filesystems {
+		if filesystem.ID == idOrName || filesystem.Name == idOrName {
+			return filesystem, nil
+		}
+	}
+
+	return api.Filesystem{}, fmt.Errorf("no filesystem with ID or name %q", idOrName)
+}
+
+func init() {
+	rootCmd.AddCommand(fsCmd)
+	fsCmd.AddCommand(fsListCmd, fsCreateCmd, fsDeleteCmd)
+
+	fsCreateCmd.Flags().String("region", "", "Region to create the filesystem in (default is the configured region)")
+	fsDeleteCmd.Flags().BoolP("yes", "y", false, "Skip confirmation")
+}
@@ -1,28 +1,64 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
+	"os"
+	"strings"
 
 	"lambdactl/pkg/api"
+	"lambdactl/pkg/filter"
+	"lambdactl/pkg/output"
+	"lambdactl/pkg/sshlib"
+	"lambdactl/pkg/tags"
 
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
-	"gopkg.in/yaml.v3"
 )
 
 var listCmd = &cobra.Command{
 	Use:   "list",
 	Short: "List all launched instances",
-	Run:   listFunc,
+	RunE:  listFunc,
 }
 
-func listFunc(cmd *cobra.Command, args []string) {
-	client := api.NewAPIClient(viper.GetString("apiUrl"), viper.GetString("apiKey"))
+var instanceTable = output.Table[api.InstanceDetails]{
+	Columns: []output.Column[api.InstanceDetails]{
+		{Header: "NAME", Value: func(i api.InstanceDetails) string { return i.Name }},
+		{Header: "ID", Value: func(i api.InstanceDetails) string { return i.ID }},
+		{Header: "STATUS", Value: func(i api.InstanceDetails) string { return i.Status }},
+		{Header: "REGION", Value: func(i api.InstanceDetails) string { return i.Region.Name }},
+		{Header: "TYPE", Value: func(i api.InstanceDetails) string { return i.InstanceType.Name }},
+		{Header: "IP", Value: func(i api.InstanceDetails) string { return i.IP }},
+		{Header: "PRIVATE IP", Wide: true, Value: func(i api.InstanceDetails) string { return i.PrivateIP }},
+		{Header: "GPUS", Wide: true, Value: func(i api.InstanceDetails) string { return fmt.Sprint(i.InstanceType.Specs.GPUs) }},
+		{Header: "$/HOUR", Wide: true, Value: func(i api.InstanceDetails) string { return dollars(i.InstanceType.PriceCentsPerHour) }},
+		{Header: "FILESYSTEMS", Wide: true, Value: func(i api.InstanceDetails) string { return strings.Join(i.Filesystems, ",") }},
+		{Header: "SSH KEYS", Wide: true, Value: func(i api.InstanceDetails) string { return strings.Join(i.SSHKeys, ",") }},
+		{Header: "TAGS", Wide: true, Value: func(i api.InstanceDetails) string { return tags.Format(i.Tags) }},
+	},
+	// Name or ID, either of which resolveInstances accepts
+	Name: api.InstanceDetails.Label,
+}
+
+func listFunc(cmd *cobra.Command, args []string) error {
+	format, err := outputFormat(cmd, output.YAMLKind)
+	if err != nil {
+		return err
+	}
+
+	f, err := filterFromFlags(cmd, api.IsInstanceField)
+	if err != nil {
+		return err
+	}
+
+	client, err := newAPIClient(cmd.Context())
+	if err != nil {
+		return fmt.Errorf("error creating API client: %v", err)
+	}
 
-	instances, err := client.ListInstances()
+	instances, err := listInstances(cmd.Context(), client)
 	if err != nil {
-		fmt.Printf("error listing instance: %v", err)
-		return
+		return fmt.Errorf("error listing instance: %w", err)
 	}
 
 	// Update some specs from type
@@ -33,14 +69,47 @@ func listFunc(cmd *cobra.Command, args []string) {
 	// 	}
 	// }
 
-	output, err := yaml.Marshal(instances)
+	return output.PrintList(os.Stdout, format, filter.Apply(f, instances), instanceTable)
+}
+
+// All instances with their local tags
+func listInstances(ctx context.Context, client *api.APIClient) ([]api.InstanceDetails, error) {
+	instances, err := client.ListInstances(ctx)
 	if err != nil {
-		fmt.Printf("error marshalling instance: %v", err)
-		return
+		return nil, err
 	}
-	fmt.Println(string(output))
+
+	store, err := tags.Open()
+	if err != nil {
+		return nil, err
+	}
+	store.Annotate(instances)
+
+	return instances, nil
+}
+
+// Forget host keys of released IPs before connecting, so a reused one doesn't
+// look like an attack
+func pruneReleasedHosts(instances []api.InstanceDetails) error {
+	_, err := sshlib.PruneKnownHosts(api.ReleasedIPs(instances))
+	return err
+}
+
+func instanceIPs(instances []api.InstanceDetails) []string {
+	var ips []string
+	for _, instance := range instances {
+		ips = append(ips, instance.IP, instance.PrivateIP)
+	}
+	return ips
+}
+
+// Cents as a dollar amount without the sign
+func dollars(cents int) string {
+	return fmt.Sprintf("%.2f", float64(cents)/100)
 }
 
 func init() {
 	rootCmd.AddCommand(listCmd)
+
+	addFilterFlag(listCmd)
 }
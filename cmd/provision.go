@@ -1,27 +1,243 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"math"
+	"os"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+
+	"lambdactl/pkg/api"
+	"lambdactl/pkg/tags"
 
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 )
 
+var errNoCriteria = errors.New("specify at least one of --type, --region, --gpu, --min-gpus, --min-vcpus, --min-memory, --min-storage or --max-price")
+
 var launchCmd = &cobra.Command{
 	Use:   "launch",
 	Short: "Launch new instances",
-	Run: func(cmd *cobra.Command, args []string) {
-		vmType, _ := cmd.Flags().GetString("type")
-		region, _ := cmd.Flags().GetString("region")
-		count, _ := cmd.Flags().GetInt("count")
-		fmt.Printf("Launching %d instance(s) of type %s in region %s\n", count, vmType, region)
-		// Add your provisioning logic here
-	},
+	RunE:  launchFunc,
+}
+
+func launchFunc(cmd *cobra.Command, args []string) error {
+	count, _ := cmd.Flags().GetInt("count")
+	wait, _ := cmd.Flags().GetBool("wait")
+	filesystems, _ := cmd.Flags().GetStringSlice("filesystem")
+	nameTemplate, _ := cmd.Flags().GetString("name")
+	tagPairs, _ := cmd.Flags().GetStringSlice("tag")
+
+	if err := textOutputOnly(cmd); err != nil {
+		return err
+	}
+
+	instanceTags, err := tags.ParseTags(tagPairs)
+	if err != nil {
+		return err
+	}
+
+	client, err := newAPIClient(cmd.Context())
+	if err != nil {
+		return err
+	}
+
+	criteria := criteriaFromFlags(cmd)
+	if criteria.Regions, err = filesystemRegions(cmd.Context(), client, criteria.Regions, filesystems); err != nil {
+		return err
+	}
+	criteria.Regions = regionsOrDefault(criteria.Regions)
+
+	// Refuse to pick "anything cheapest" by accident
+	if criteria.IsEmpty() {
+		return errNoCriteria
+	}
+
+	// Resolve the request against what's actually available right now
+	options, err := client.FetchInstanceOptions(cmd.Context())
+	if err != nil {
+		return err
+	}
+
+	candidates := api.RankInstanceOptions(options, criteria)
+	if len(candidates) == 0 {
+		return errors.New("no instance type with capacity matches the requested criteria")
+	}
+
+	batches, err := launchBatches(nameTemplate, count, filesystems)
+	if err != nil {
+		return err
+	}
+
+	// Checked once for every batch
+	sshKeyNames, err := client.ValidateSSHKeyNames(cmd.Context(), viper.GetStringSlice("ssh-key-names"))
+	if err != nil {
+		return err
+	}
+
+	launched := api.InstanceLaunchData{}
+	for _, batch := range batches {
+		batch.SSHKeyNames = sshKeyNames
+
+		// Capacity can vanish between listing and launching, so fall through the ranking
+		option, batchLaunched, err := client.LaunchFirstAvailable(cmd.Context(), candidates, batch, func(skipped api.InstanceOption, err error) {
+			fmt.Fprintf(os.Stderr, "No capacity for %s in %s, trying the next option\n", skipped.Type.Name, skipped.Region)
+		})
+		if err != nil {
+			// Don't lose track of what's already running
+			for _, id := range launched.InstanceIDs {
+				fmt.Println(id)
+			}
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Launched %d x %s in %s ($%.2f/hour each)\n", len(batchLaunched.InstanceIDs), option.Type.Name, option.Region, float64(option.Type.PriceCentsPerHour)/100)
+
+		launched.InstanceIDs = append(launched.InstanceIDs, batchLaunched.InstanceIDs...)
+		if err := tagInstances(batchLaunched.InstanceIDs, instanceTags); err != nil {
+			return err
+		}
+	}
+
+	if !wait {
+		for _, id := range launched.InstanceIDs {
+			fmt.Println(id)
+		}
+		return nil
+	}
+
+	ctx, cancel, waitOptions := waitFromFlags(cmd)
+	defer cancel()
+
+	instances, err := client.WaitForInstances(ctx, launched.InstanceIDs, waitOptions)
+	if err != nil {
+		return err
+	}
+
+	// Keep launch order stable for scripts
+	for _, id := range launched.InstanceIDs {
+		fmt.Printf("%s\t%s\n", id, instances[id].IP)
+	}
+
+	return nil
+}
+
+// Data available to --name templates
+type nameTemplateData struct {
+	Index int // 0-based position in this launch
+	Count int // Instances in this launch
+}
+
+// Split a launch so every distinct name gets its own request, since the API
+// gives every instance of one request the same name
+func launchBatches(nameTemplate string, count int, filesystems []string) ([]api.LaunchOptions, error) {
+	count = max(count, 1)
+	if nameTemplate == "" {
+		return []api.LaunchOptions{{Quantity: count, FilesystemNames: filesystems}}, nil
+	}
+
+	tmpl, err := template.New("name").Option("missingkey=error").Parse(nameTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --name template: %v", err)
+	}
+
+	names := make([]string, count)
+	for i := range names {
+		var b strings.Builder
+		if err := tmpl.Execute(&b, nameTemplateData{Index: i, Count: count}); err != nil {
+			return nil, fmt.Errorf("invalid --name template: %v", err)
+		}
+		names[i] = b.String()
+	}
+
+	// Runs of the same name share a request, so a fixed name is one request
+	var batches []api.LaunchOptions
+	for _, name := range names {
+		if last := len(batches) - 1; last >= 0 && batches[last].Name == name {
+			batches[last].Quantity++
+			continue
+		}
+		batches = append(batches, api.LaunchOptions{Quantity: 1, Name: name, FilesystemNames: filesystems})
+	}
+	return batches, nil
+}
+
+// Flags describing acceptable instance options, shared by launch and watch-capacity
+func addCriteriaFlags(cmd *cobra.Command) {
+	cmd.Flags().StringSlice("type", nil, "Acceptable instance type(s), most preferred first")
+	cmd.Flags().StringSlice("region", nil, "Acceptable region(s), most preferred first (default is the configured region)")
+	cmd.Flags().Int("min-gpus", 0, "Minimum number of GPUs")
+	cmd.Flags().String("gpu", "", "GPU model, matched as a substring of the description (e.g. H100)")
+	cmd.Flags().Int("min-vcpus", 0, "Minimum number of vCPUs")
+	cmd.Flags().Int("min-memory", 0, "Minimum memory in GiB")
+	cmd.Flags().Int("min-storage", 0, "Minimum storage in GiB")
+	cmd.Flags().Float64("max-price", 0, "Maximum price in $/hour per instance")
+}
+
+func criteriaFromFlags(cmd *cobra.Command) api.InstanceCriteria {
+	var criteria api.InstanceCriteria
+	criteria.Types, _ = cmd.Flags().GetStringSlice("type")
+	criteria.Regions, _ = cmd.Flags().GetStringSlice("region")
+	criteria.MinGPUs, _ = cmd.Flags().GetInt("min-gpus")
+	criteria.GPUModel, _ = cmd.Flags().GetString("gpu")
+	criteria.MinVCPUs, _ = cmd.Flags().GetInt("min-vcpus")
+	criteria.MinMemoryGiB, _ = cmd.Flags().GetInt("min-memory")
+	criteria.MinStorageGiB, _ = cmd.Flags().GetInt("min-storage")
+	maxPrice, _ := cmd.Flags().GetFloat64("max-price")
+	criteria.MaxPriceCents = int(math.Round(maxPrice * 100))
+	return criteria
+}
+
+// Fall back to the profile's default region when none were asked for
+func regionsOrDefault(regions []string) []string {
+	if len(regions) == 0 && viper.GetString("region") != "" {
+		return []string{viper.GetString("region")}
+	}
+	return regions
+}
+
+// Narrow regions to the one the named filesystems are in, they can only be
+// attached there
+func filesystemRegions(ctx context.Context, client *api.APIClient, regions, names []string) ([]string, error) {
+	if len(names) == 0 {
+		return regions, nil
+	}
+
+	filesystems, err := client.ListFilesystems(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	region := ""
+	for _, name := range names {
+		i := slices.IndexFunc(filesystems, func(fs api.Filesystem) bool { return fs.Name == name })
+		if i < 0 {
+			return nil, fmt.Errorf("filesystem %s not found", name)
+		}
+		if fsRegion := filesystems[i].Region.Name; region == "" {
+			region = fsRegion
+		} else if fsRegion != region {
+			return nil, fmt.Errorf("filesystems %s are in different regions, an instance can only attach ones in its own", strings.Join(names, ", "))
+		}
+	}
+
+	if len(regions) > 0 && !slices.Contains(regions, region) {
+		return nil, fmt.Errorf("filesystem(s) %s are in %s, which isn't one of the requested regions", strings.Join(names, ", "), region)
+	}
+	return []string{region}, nil
 }
 
 func init() {
 	rootCmd.AddCommand(launchCmd)
 
-	launchCmd.Flags().String("type", "gpu_1x_h100_sxm5", "Instance type")
-	launchCmd.Flags().String("region", "us-south-2", "Region")
+	addCriteriaFlags(launchCmd)
 	launchCmd.Flags().Int("count", 1, "Number of instances")
+	launchCmd.Flags().StringSlice("filesystem", nil, "Filesystem(s) to attach, by name")
+	launchCmd.Flags().String("name", "", "Instance name, a template with {{.Index}} and {{.Count}} (e.g. train-{{.Index}})")
+	launchCmd.Flags().StringSlice("tag", nil, "Local tag(s) to record as key=value")
+	addWaitFlags(launchCmd, "active and print their IPs", 20*time.Minute)
 }
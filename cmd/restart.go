@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+var restartCmd = &cobra.Command{
+	Use:   "restart [id|name]...",
+	Short: "Restart instances by ID, name or filter",
+	RunE:  restartFunc,
+}
+
+func restartFunc(cmd *cobra.Command, args []string) error {
+	yes, _ := cmd.Flags().GetBool("yes")
+
+	if err := textOutputOnly(cmd); err != nil {
+		return err
+	}
+
+	client, err := newAPIClient(cmd.Context())
+	if err != nil {
+		return err
+	}
+
+	targets, err := selectInstances(cmd, client, args, nil)
+	if err != nil {
+		return err
+	}
+
+	if !yes {
+		ok, err := confirm(fmt.Sprintf("Restart %d instance(s)?", len(targets)), describeInstances(targets))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			fmt.Println("Aborted.")
+			return nil
+		}
+	}
+
+	restarted, err := client.RestartInstances(cmd.Context(), instanceIDs(targets))
+	if err != nil {
+		return err
+	}
+
+	for _, instance := range restarted {
+		fmt.Printf("%s\t%s\n", instance.ID, instance.Status)
+	}
+
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(restartCmd)
+
+	restartCmd.Flags().BoolP("yes", "y", false, "Skip confirmation")
+	addFilterFlag(restartCmd)
+}
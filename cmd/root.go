@@ -1,11 +1,21 @@
 package cmd
 
 import (
+	"context"
 	"embed"
 	"fmt"
+	"maps"
 	"os"
+	"os/signal"
+	"slices"
+	"sort"
 	"strings"
 
+	"lambdactl/pkg/api"
+	"lambdactl/pkg/config"
+	"lambdactl/pkg/filter"
+	"lambdactl/pkg/output"
+	"lambdactl/pkg/secrets"
 	"lambdactl/pkg/ui"
 
 	"github.com/spf13/cobra"
@@ -16,22 +26,54 @@ var lambdaFS embed.FS
 
 var cfgFile string
 
+var profileName string
+
+// Problems loading config, reported once a command needs it
+var configErr error
+
+// Annotation for commands that run without the required config keys
+const skipConfigCheck = "skip-config-check"
+
 var rootCmd = &cobra.Command{
 	Use:   "lambdactl",
 	Short: "A CLI for managing Lambda instances",
+	// Errors are printed once by Execute, without the usage dump
+	SilenceErrors: true,
+	SilenceUsage:  true,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		// Config commands have to work before there's a usable config
+		for c := cmd; c != nil; c = c.Parent() {
+			if c.Annotations[skipConfigCheck] == "true" {
+				return nil
+			}
+		}
+		if configErr != nil {
+			return configErr
+		}
+		return checkRequiredConfig()
+	},
 	RunE: func(cmd *cobra.Command, args []string) error {
-		return ui.Start()
+		// Validate up front, the TUI can only flash errors
+		if _, err := filterFromFlags(cmd, api.IsInstanceField); err != nil {
+			return err
+		}
+		expr, _ := cmd.Flags().GetString("filter")
+		return ui.Start(cmd.Context(), expr)
 	},
 }
 
 func Execute(fs embed.FS) {
 	lambdaFS = fs
 
-	initConfig()
-	checkRequiredConfig()
+	// Cancel in-flight requests and waits on Ctrl-C
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
 
-	if err := rootCmd.Execute(); err != nil {
+	if err := rootCmd.ExecuteContext(ctx); err != nil {
 		fmt.Println(err)
+		if suggestion := api.Suggestion(err); suggestion != "" {
+			fmt.Printf("Suggestion: %s\n", suggestion)
+		}
 		os.Exit(1)
 	}
 }
@@ -39,6 +81,9 @@ func Execute(fs embed.FS) {
 func init() {
 	cobra.OnInitialize(initConfig)
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.lambda.yaml)")
+	rootCmd.PersistentFlags().StringVar(&profileName, "profile", "", "config profile to use (default is $LAMBDA_PROFILE or the profile key)")
+	addFilterFlag(rootCmd)
+	rootCmd.PersistentFlags().StringP("output", "o", "", "Output format: yaml, json, table, wide, name, go-template=..., jsonpath=... (default depends on the command)")
 }
 
 func initConfig() {
@@ -53,6 +98,10 @@ func initConfig() {
 		viper.SetConfigName(".lambda")
 	}
 
+	viper.SetDefault("api-url", api.DefaultBaseURL)
+	viper.SetDefault("ssh-user", "ubuntu")
+	viper.SetDefault("ssh-key-file", "id_rsa")
+
 	// Override with LAMBDA_* env vars, where . and - map to _
 	viper.SetEnvPrefix("LAMBDA")
 	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_", "-", "_"))
@@ -64,10 +113,79 @@ func initConfig() {
 			fmt.Printf("Error reading config file: %v\n", err)
 		}
 	}
+
+	// Configs from before the schema keep working, their keys fill in the new ones
+	for legacy, key := range config.Legacy {
+		if viper.InConfig(legacy) && !viper.InConfig(key) {
+			cobra.CheckErr(viper.MergeConfigMap(map[string]any{key: viper.Get(legacy)}))
+		}
+	}
+
+	// Catch typos and bad values before they turn into confusing API or SSH errors
+	var warnings []config.Problem
+	warnings, configErr = config.Validate(viper.AllSettings())
+	for _, warning := range warnings {
+		fmt.Fprintf(os.Stderr, "Warning: config %s: %s\n", warning.Key, warning.Message)
+	}
+	if configErr == nil {
+		configErr = applyProfile()
+	}
+}
+
+// Profile selected by --profile, then LAMBDA_PROFILE, then the profile key
+func activeProfile() string {
+	if profileName != "" {
+		return profileName
+	}
+	return viper.GetString("profile")
+}
+
+// Layer the active profile's keys over the top-level ones. They merge into the
+// config layer, so LAMBDA_* env vars still win over both.
+func applyProfile() error {
+	name := activeProfile()
+	if name == "" {
+		return nil
+	}
+
+	if !viper.IsSet("profiles." + name) {
+		return fmt.Errorf("unknown profile %q, have %v", name, profileNames())
+	}
+
+	// viper hands back its own map, don't write the blanks into it
+	settings := maps.Clone(viper.GetStringMap("profiles." + name))
+
+	// A profile's key source replaces the top-level one rather than queueing
+	// behind it, so blank out the sources it doesn't set
+	sources := []string{"api-key", "api-key-command", "api-key-file", "api-key-keyring"}
+	if slices.ContainsFunc(sources, func(key string) bool { _, ok := settings[key]; return ok }) {
+		for _, key := range sources {
+			if _, ok := settings[key]; !ok {
+				settings[key] = ""
+			}
+		}
+	}
+
+	if err := viper.MergeConfigMap(settings); err != nil {
+		return err
+	}
+
+	// Per-account state, like the tag store, is kept per profile
+	viper.Set("profile", name)
+	return nil
+}
+
+func profileNames() []string {
+	names := []string{}
+	for name := range viper.GetStringMap("profiles") {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
 }
 
-func checkRequiredConfig() {
-	requiredKeys := []string{"api-url", "api-key"}
+func checkRequiredConfig() error {
+	requiredKeys := []string{"api-url"}
 	missingKeys := []string{}
 
 	for _, key := range requiredKeys {
@@ -75,9 +193,59 @@ func checkRequiredConfig() {
 			missingKeys = append(missingKeys, key)
 		}
 	}
+	// Only check one is configured, resolving may prompt
+	if secrets.SourceFromConfig().IsEmpty() {
+		missingKeys = append(missingKeys, "api-key (or api-key-command, api-key-file, api-key-keyring)")
+	}
 
 	if len(missingKeys) > 0 {
-		fmt.Printf("Missing required configuration keys: %v\n", missingKeys)
-		os.Exit(1)
+		return fmt.Errorf("missing required configuration keys: %v, run lambdactl config init to set them up", missingKeys)
+	}
+	return nil
+}
+
+// Format from --output, or the command's own default
+func outputFormat(cmd *cobra.Command, fallback string) (output.Format, error) {
+	value, _ := cmd.Flags().GetString("output")
+	return output.ParseFormat(value, fallback)
+}
+
+// For commands that only print text, so --output errors rather than being
+// silently ignored
+func textOutputOnly(cmd *cobra.Command) error {
+	format, err := outputFormat(cmd, output.TableKind)
+	if err != nil {
+		return err
+	}
+	if format.Kind != output.TableKind {
+		return fmt.Errorf("%s only prints text, output format %q is not supported", cmd.CommandPath(), format.Kind)
+	}
+	return nil
+}
+
+func addFilterFlag(cmd *cobra.Command) {
+	cmd.Flags().StringP("filter", "f", "", "Only include matches, e.g. status=active,region=us-east-1|us-west-1,gpus>=8,name~train-*")
+}
+
+// Filter from --filter, with keys checked against known
+func filterFromFlags(cmd *cobra.Command, known func(string) bool) (filter.Filter, error) {
+	expr, _ := cmd.Flags().GetString("filter")
+
+	f, err := filter.Parse(expr)
+	if err != nil {
+		return nil, err
+	}
+	if err := f.Check(known); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Client for the configured account, resolving the API key from its source
+func newAPIClient(ctx context.Context) (*api.APIClient, error) {
+	apiKey, err := secrets.SourceFromConfig().Resolve(ctx)
+	if err != nil {
+		return nil, err
 	}
+	return api.NewAPIClient(viper.GetString("api-url"), apiKey, api.ConfigOptions()...)
 }
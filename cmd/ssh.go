@@ -14,18 +14,59 @@ var sshCmd = &cobra.Command{
 
 func sshFunc(cmd *cobra.Command, args []string) error {
 	host, _ := cmd.Flags().GetString("host")
-	port, _ := cmd.Flags().GetInt("port")
-	user, _ := cmd.Flags().GetString("user")
-	keyName, _ := cmd.Flags().GetString("keyName")
-	return sshlib.NewShell(host, port, user, keyName)
+
+	target, err := sshTargetFromFlags(cmd, host)
+	if err != nil {
+		return err
+	}
+	return sshlib.NewShell(target)
+}
+
+// Flags shared by every command that opens SSH connections
+func addSSHFlags(cmd *cobra.Command) {
+	cmd.Flags().Int("port", 0, "Remote port (default from ~/.ssh/config, else 22)")
+	cmd.Flags().String("user", "", "Remote user (default from ~/.ssh/config, else ssh-user)")
+	cmd.Flags().String("keyName", "", "SSH key name or path (default from ~/.ssh/config, else ssh-key-file)")
+	cmd.Flags().Bool("replace-host-key", false, "Accept and record a changed host key, e.g. when an IP was reused by a new instance")
+	cmd.Flags().Duration("keepalive", 0, "Interval between keepalives, 0 disables them (default from ~/.ssh/config, else ssh-keepalive, else 30s)")
+	cmd.Flags().String("jump", "", "Jump host(s) as user@host:port, comma-separated, or none (default from ~/.ssh/config, else ssh-jump)")
+}
+
+// Target for host with only the flags that were given, so ~/.ssh/config and
+// the lambdactl config fill in the rest
+func sshTargetFromFlags(cmd *cobra.Command, host string) (sshlib.SSHTarget, error) {
+	target := sshlib.SSHTarget{Host: host}
+	if cmd.Flags().Changed("port") {
+		target.Port, _ = cmd.Flags().GetInt("port")
+	}
+	if cmd.Flags().Changed("user") {
+		target.User, _ = cmd.Flags().GetString("user")
+	}
+	if cmd.Flags().Changed("keyName") {
+		target.KeyName, _ = cmd.Flags().GetString("keyName")
+	}
+	if cmd.Flags().Changed("jump") {
+		spec, _ := cmd.Flags().GetString("jump")
+		jumps, err := sshlib.ParseJumps(spec)
+		if err != nil {
+			return target, err
+		}
+		target.Jumps = jumps
+	}
+	if cmd.Flags().Changed("keepalive") {
+		target.KeepAlive, _ = cmd.Flags().GetDuration("keepalive")
+		if target.KeepAlive == 0 {
+			target.KeepAlive = -1
+		}
+	}
+	target.ReplaceHostKey, _ = cmd.Flags().GetBool("replace-host-key")
+	return target, nil
 }
 
 func init() {
 	rootCmd.AddCommand(sshCmd)
 
+	sshCmd.Flags().String("host", "", "Hostname, IP or ~/.ssh/config alias")
 	sshCmd.MarkFlagRequired("host")
-	sshCmd.Flags().String("host", "", "Hostname or IP")
-	sshCmd.Flags().Int("port", 22, "Remote port")
-	sshCmd.Flags().String("user", "ubuntu", "Remote user")
-	sshCmd.Flags().String("keyName", "id_rsa", "SSH Key Name")
+	addSSHFlags(sshCmd)
 }
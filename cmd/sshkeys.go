@@ -0,0 +1,197 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"lambdactl/pkg/api"
+	"lambdactl/pkg/output"
+
+	"github.com/spf13/cobra"
+)
+
+var sshKeysCmd = &cobra.Command{
+	Use:   "ssh-keys",
+	Short: "Manage SSH keys on the account",
+}
+
+var sshKeysListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List SSH keys",
+	Args:  cobra.NoArgs,
+	RunE:  sshKeysListFunc,
+}
+
+var sshKeysAddCmd = &cobra.Command{
+	Use:   "add <name> <public-key-file>",
+	Short: "Upload an existing public key",
+	Args:  cobra.ExactArgs(2),
+	RunE:  sshKeysAddFunc,
+}
+
+var sshKeysGenerateCmd = &cobra.Command{
+	Use:   "generate <name>",
+	Short: "Generate a new key pair and save the private key under ~/.ssh",
+	Args:  cobra.ExactArgs(1),
+	RunE:  sshKeysGenerateFunc,
+}
+
+var sshKeysDeleteCmd = &cobra.Command{
+	Use:   "delete <id|name>",
+	Short: "Delete an SSH key",
+	Args:  cobra.ExactArgs(1),
+	RunE:  sshKeysDeleteFunc,
+}
+
+var sshKeyTable = output.Table[api.SSHKey]{
+	Columns: []output.Column[api.SSHKey]{
+		{Header: "NAME", Value: func(k api.SSHKey) string { return k.Name }},
+		{Header: "ID", Value: func(k api.SSHKey) string { return k.ID }},
+		{Header: "PUBLIC KEY", Wide: true, Value: func(k api.SSHKey) string { return k.PublicKey }},
+	},
+	Name: func(k api.SSHKey) string { return k.Name },
+}
+
+func sshKeysListFunc(cmd *cobra.Command, args []string) error {
+	format, err := outputFormat(cmd, output.YAMLKind)
+	if err != nil {
+		return err
+	}
+
+	client, err := newAPIClient(cmd.Context())
+	if err != nil {
+		return err
+	}
+
+	keys, err := client.ListSSHKeys(cmd.Context())
+	if err != nil {
+		return err
+	}
+
+	return output.PrintList(os.Stdout, format, keys, sshKeyTable)
+}
+
+func sshKeysAddFunc(cmd *cobra.Command, args []string) error {
+	name, keyFile := args[0], args[1]
+
+	publicKey, err := os.ReadFile(keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to read public key: %v", err)
+	}
+
+	client, err := newAPIClient(cmd.Context())
+	if err != nil {
+		return err
+	}
+
+	key, err := client.AddSSHKey(cmd.Context(), name, strings.TrimSpace(string(publicKey)))
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Added SSH key %s (%s)\n", key.Name, key.ID)
+	return nil
+}
+
+func sshKeysGenerateFunc(cmd *cobra.Command, args []string) error {
+	name := args[0]
+
+	// The name becomes a file under ~/.ssh, don't let it point anywhere else
+	if name == "" || name == "." || strings.Contains(name, "..") || strings.ContainsAny(name, `/\`) {
+		return fmt.Errorf("invalid key name %q, it can't contain path separators or ..", name)
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return err
+	}
+	privateKeyFile := filepath.Join(home, ".ssh", name)
+
+	// Check before generating, the API only hands out the private key once
+	if _, err := os.Stat(privateKeyFile); err == nil {
+		return fmt.Errorf("%s already exists, refusing to overwrite", privateKeyFile)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	client, err := newAPIClient(cmd.Context())
+	if err != nil {
+		return err
+	}
+
+	key, err := client.GenerateSSHKey(cmd.Context(), name)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(privateKeyFile), 0700); err != nil {
+		return fmt.Errorf("failed to create ssh directory: %v", err)
+	}
+	if err := os.WriteFile(privateKeyFile, []byte(key.PrivateKey), 0600); err != nil {
+		return fmt.Errorf("failed to save private key: %v", err)
+	}
+	if err := os.WriteFile(privateKeyFile+".pub", []byte(key.PublicKey+"\n"), 0644); err != nil {
+		return fmt.Errorf("failed to save public key: %v", err)
+	}
+
+	fmt.Printf("Generated SSH key %s (%s), private key saved to %s\n", key.Name, key.ID, privateKeyFile)
+	return nil
+}
+
+func sshKeysDeleteFunc(cmd *cobra.Command, args []string) error {
+	yes, _ := cmd.Flags().GetBool("yes")
+
+	client, err := newAPIClient(cmd.Context())
+	if err != nil {
+		return err
+	}
+
+	key, err := resolveSSHKey(cmd.Context(), client, args[0])
+	if err != nil {
+		return err
+	}
+
+	if !yes {
+		ok, err := confirm(fmt.Sprintf("Delete SSH key %s?", key.Name), key.ID)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			fmt.Println("Aborted.")
+			return nil
+		}
+	}
+
+	if err := client.DeleteSSHKey(cmd.Context(), key.ID); err != nil {
+		return err
+	}
+
+	fmt.Printf("Deleted SSH key %s (%s)\n", key.Name, key.ID)
+	return nil
+}
+
+func resolveSSHKey(ctx context.Context, client *api.APIClient, idOrName string) (api.SSHKey, error) {
+	keys, err := client.ListSSHKeys(ctx)
+	if err != nil {
+		return api.SSHKey{}, err
+	}
+
+	for _, key := range keys {
+		if key.ID == idOrName || key.Name == idOrName {
+			return key, nil
+		}
+	}
+
+	return api.SSHKey{}, fmt.Errorf("no SSH key with ID or name %q", idOrName)
+}
+
+func init() {
+	rootCmd.AddCommand(sshKeysCmd)
+	sshKeysCmd.AddCommand(sshKeysListCmd, sshKeysAddCmd, sshKeysGenerateCmd, sshKeysDeleteCmd)
+
+	sshKeysDeleteCmd.Flags().BoolP("yes", "y", false, "Skip confirmation")
+}
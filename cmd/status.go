@@ -1,7 +1,20 @@
 package cmd
 
 import (
+	"bytes"
+	"context"
 	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"lambdactl/pkg/api"
+	"lambdactl/pkg/output"
+	"lambdactl/pkg/sshlib"
 
 	"github.com/spf13/cobra"
 )
@@ -9,11 +22,217 @@ import (
 var statusCmd = &cobra.Command{
 	Use:   "status",
 	Short: "Check status of instances",
-	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Println("Getting status...")
-	},
+	Args:  cobra.NoArgs,
+	RunE:  statusFunc,
+}
+
+// Fleet summary, optionally with per-instance probe results
+type statusReport struct {
+	Instances        int            `json:"instances" yaml:"Instances"`
+	GPUs             int            `json:"gpus" yaml:"GPUs"`
+	BurnCentsPerHour int            `json:"burn_cents_per_hour" yaml:"BurnCentsPerHour"`
+	ByStatus         map[string]int `json:"by_status" yaml:"ByStatus"`
+	ByRegion         map[string]int `json:"by_region" yaml:"ByRegion"`
+	ByType           map[string]int `json:"by_type" yaml:"ByType"`
+	Probes           []probeResult  `json:"probes,omitempty" yaml:"Probes,omitempty"`
+}
+
+type probeResult struct {
+	ID          string   `json:"id" yaml:"ID"`
+	Name        string   `json:"name" yaml:"Name"`
+	IP          string   `json:"ip" yaml:"IP"`
+	Reachable   bool     `json:"reachable" yaml:"Reachable"`
+	Uptime      string   `json:"uptime,omitempty" yaml:"Uptime,omitempty"`
+	GPUsHealthy bool     `json:"gpus_healthy" yaml:"GPUsHealthy"`
+	GPUs        []string `json:"gpus,omitempty" yaml:"GPUs,omitempty"`
+	Error       string   `json:"error,omitempty" yaml:"Error,omitempty"`
+
+	label string // The instance's Label, for the table
+}
+
+func statusFunc(cmd *cobra.Command, args []string) error {
+	probe, _ := cmd.Flags().GetBool("probe")
+	parallel, _ := cmd.Flags().GetInt("parallel")
+
+	format, err := outputFormat(cmd, output.TableKind)
+	if err != nil {
+		return err
+	}
+
+	client, err := newAPIClient(cmd.Context())
+	if err != nil {
+		return err
+	}
+
+	instances, err := listInstances(cmd.Context(), client)
+	if err != nil {
+		return err
+	}
+
+	report := summarizeInstances(instances)
+	if probe {
+		target, err := sshTargetFromFlags(cmd, "")
+		if err != nil {
+			return err
+		}
+		if err := pruneReleasedHosts(instances); err != nil {
+			return err
+		}
+		report.Probes = probeInstances(cmd.Context(), instances, parallel, target)
+	}
+
+	return output.Print(os.Stdout, format, report, func(w io.Writer, wide bool) error {
+		return printStatusReport(w, report, wide)
+	})
+}
+
+// Group instances and total up what the fleet is costing
+func summarizeInstances(instances []api.InstanceDetails) statusReport {
+	report := statusReport{
+		ByStatus: map[string]int{},
+		ByRegion: map[string]int{},
+		ByType:   map[string]int{},
+	}
+
+	for _, instance := range instances {
+		report.ByStatus[instance.Status]++
+
+		// Gone and going instances linger in the list but no longer bill
+		if api.IsGone(instance.Status) || instance.Status == api.StatusTerminating {
+			continue
+		}
+
+		report.Instances++
+		report.ByRegion[instance.Region.Name]++
+		report.ByType[instance.InstanceType.Name]++
+		report.GPUs += instance.InstanceType.Specs.GPUs
+		report.BurnCentsPerHour += instance.InstanceType.PriceCentsPerHour
+	}
+
+	return report
+}
+
+// SSH into every active instance, a few at a time, with target's settings
+func probeInstances(ctx context.Context, instances []api.InstanceDetails, parallel int, target sshlib.SSHTarget) []probeResult {
+	var active []api.InstanceDetails
+	for _, instance := range instances {
+		if instance.Status == api.StatusActive && instance.IP != "" {
+			active = append(active, instance)
+		}
+	}
+
+	results := make([]probeResult, len(active))
+	sem := make(chan struct{}, max(parallel, 1))
+	var wg sync.WaitGroup
+	for i, instance := range active {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			results[i] = probeInstance(ctx, instance, target)
+		}()
+	}
+	wg.Wait()
+
+	return results
+}
+
+// A wedged driver can hang nvidia-smi indefinitely
+const probeCommandTimeout = 30 * time.Second
+
+func probeInstance(ctx context.Context, instance api.InstanceDetails, target sshlib.SSHTarget) probeResult {
+	result := probeResult{
+		ID:    instance.ID,
+		Name:  instance.Name,
+		IP:    instance.IP,
+		label: instance.Label(),
+	}
+
+	target.Host = instance.IP
+	client, err := sshlib.NewSSHClient(target)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	defer client.Client.Close()
+	result.Reachable = true
+
+	ctx, cancel := context.WithTimeout(ctx, probeCommandTimeout)
+	defer cancel()
+
+	if uptime, err := client.Exec(ctx, "uptime -p", sshlib.ExecOptions{}); err == nil {
+		result.Uptime = strings.TrimPrefix(strings.TrimSpace(string(uptime.Stdout)), "up ")
+	}
+
+	// Healthy means nvidia-smi works and sees every GPU the type promises
+	query := "nvidia-smi --query-gpu=index,name,temperature.gpu,utilization.gpu,memory.used,memory.total --format=csv,noheader"
+	output, err := client.Exec(ctx, query, sshlib.ExecOptions{})
+	if err != nil {
+		result.Error = fmt.Sprintf("nvidia-smi: %v", err)
+		if output != nil && len(bytes.TrimSpace(output.Stderr)) > 0 {
+			result.Error += ": " + strings.TrimSpace(string(output.Stderr))
+		}
+		return result
+	}
+	for _, line := range strings.Split(strings.TrimSpace(string(output.Stdout)), "\n") {
+		if line != "" {
+			result.GPUs = append(result.GPUs, line)
+		}
+	}
+	result.GPUsHealthy = len(result.GPUs) == instance.InstanceType.Specs.GPUs
+	if !result.GPUsHealthy {
+		result.Error = fmt.Sprintf("nvidia-smi sees %d of %d GPUs", len(result.GPUs), instance.InstanceType.Specs.GPUs)
+	}
+
+	return result
+}
+
+func printStatusReport(out io.Writer, report statusReport, wide bool) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintf(w, "Instances:\t%d\n", report.Instances)
+	fmt.Fprintf(w, "GPUs:\t%d\n", report.GPUs)
+	fmt.Fprintf(w, "Burn rate:\t$%.2f/hour ($%.2f/day)\n", float64(report.BurnCentsPerHour)/100, float64(report.BurnCentsPerHour)*24/100)
+
+	printCounts(w, "STATUS", report.ByStatus)
+	printCounts(w, "REGION", report.ByRegion)
+	printCounts(w, "TYPE", report.ByType)
+
+	if report.Probes != nil {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "NAME\tIP\tREACHABLE\tUPTIME\tGPUS\tHEALTHY\tERROR")
+		for _, probe := range report.Probes {
+			fmt.Fprintf(w, "%s\t%s\t%t\t%s\t%d\t%t\t%s\n", probe.label, probe.IP, probe.Reachable, probe.Uptime, len(probe.GPUs), probe.GPUsHealthy, probe.Error)
+			if wide {
+				for _, gpu := range probe.GPUs {
+					fmt.Fprintf(w, "\t\t\t\t%s\n", gpu)
+				}
+			}
+		}
+	}
+
+	return w.Flush()
+}
+
+func printCounts(w *tabwriter.Writer, header string, counts map[string]int) {
+	keys := make([]string, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "%s\tCOUNT\n", header)
+	for _, key := range keys {
+		fmt.Fprintf(w, "%s\t%d\n", key, counts[key])
+	}
 }
 
 func init() {
 	rootCmd.AddCommand(statusCmd)
+
+	statusCmd.Flags().Bool("probe", false, "SSH into active instances to check reachability, uptime and GPU health")
+	statusCmd.Flags().Int("parallel", 8, "Instances to probe at once")
+	addSSHFlags(statusCmd)
 }
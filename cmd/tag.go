@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"lambdactl/pkg/tags"
+
+	"github.com/spf13/cobra"
+)
+
+var tagCmd = &cobra.Command{
+	Use:   "tag [id|name]... key=value... [key-]...",
+	Short: "Set (key=value) or remove (key-) local tags on instances",
+	RunE:  tagFunc,
+}
+
+func tagFunc(cmd *cobra.Command, args []string) error {
+	if err := textOutputOnly(cmd); err != nil {
+		return err
+	}
+
+	// Tag operations look like key=value or key-, everything else names an instance
+	var refs, set, remove []string
+	for _, arg := range args {
+		switch {
+		case strings.Contains(arg, "="):
+			set = append(set, arg)
+		case strings.HasSuffix(arg, "-") && len(arg) > 1:
+			remove = append(remove, strings.TrimSuffix(arg, "-"))
+		default:
+			refs = append(refs, arg)
+		}
+	}
+	if len(set) == 0 && len(remove) == 0 {
+		return errors.New("no tags to set (key=value) or remove (key-)")
+	}
+
+	pairs, err := tags.ParseTags(set)
+	if err != nil {
+		return err
+	}
+
+	client, err := newAPIClient(cmd.Context())
+	if err != nil {
+		return err
+	}
+
+	f, err := selectionFilter(cmd, refs)
+	if err != nil {
+		return err
+	}
+
+	instances, err := listInstances(cmd.Context(), client)
+	if err != nil {
+		return err
+	}
+
+	targets, err := selectFrom(instances, refs, f, len(f) > 0)
+	if err != nil {
+		return err
+	}
+
+	var updated *tags.Store
+	err = tags.Update(func(store *tags.Store) {
+		// Writing anyway, so tidy up after instances that are gone
+		store.Prune(instances)
+
+		for _, instance := range targets {
+			for key, value := range pairs {
+				store.Set(instance.ID, key, value)
+			}
+			for _, key := range remove {
+				store.Remove(instance.ID, key)
+			}
+		}
+		updated = store
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, instance := range targets {
+		fmt.Printf("%s\t%s\n", instance.ID, tags.Format(updated.Get(instance.ID)))
+	}
+	return nil
+}
+
+// Record the same tags on each instance
+func tagInstances(ids []string, pairs map[string]string) error {
+	if len(pairs) == 0 {
+		return nil
+	}
+
+	return tags.Update(func(store *tags.Store) {
+		for _, id := range ids {
+			for key, value := range pairs {
+				store.Set(id, key, value)
+			}
+		}
+	})
+}
+
+// Drop all tags for instances that are going away
+func forgetTags(ids []string) error {
+	return tags.Update(func(store *tags.Store) {
+		for _, id := range ids {
+			store.Delete(id)
+		}
+	})
+}
+
+func init() {
+	rootCmd.AddCommand(tagCmd)
+
+	addFilterFlag(tagCmd)
+}
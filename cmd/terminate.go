@@ -0,0 +1,219 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"lambdactl/pkg/api"
+	"lambdactl/pkg/filter"
+	"lambdactl/pkg/sshlib"
+
+	"github.com/charmbracelet/huh"
+	"github.com/spf13/cobra"
+)
+
+var terminateCmd = &cobra.Command{
+	Use:   "terminate [id|name]...",
+	Short: "Terminate instances by ID, name or filter",
+	RunE:  terminateFunc,
+}
+
+func terminateFunc(cmd *cobra.Command, args []string) error {
+	yes, _ := cmd.Flags().GetBool("yes")
+	wait, _ := cmd.Flags().GetBool("wait")
+
+	if err := textOutputOnly(cmd); err != nil {
+		return err
+	}
+
+	client, err := newAPIClient(cmd.Context())
+	if err != nil {
+		return err
+	}
+
+	// Already on their way out, nothing to terminate
+	targets, err := selectInstances(cmd, client, args, func(instance api.InstanceDetails) bool {
+		return api.IsGone(instance.Status) || instance.Status == api.StatusTerminating
+	})
+	if err != nil {
+		return err
+	}
+
+	if !yes {
+		ok, err := confirm(fmt.Sprintf("Terminate %d instance(s)?", len(targets)), describeInstances(targets))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			fmt.Println("Aborted.")
+			return nil
+		}
+	}
+
+	ids := instanceIDs(targets)
+	terminated, err := client.TerminateInstances(cmd.Context(), ids)
+	if err != nil {
+		return err
+	}
+
+	for _, instance := range terminated {
+		fmt.Printf("%s\t%s\n", instance.ID, instance.Status)
+	}
+
+	if err := forgetTags(ids); err != nil {
+		return err
+	}
+
+	// Their IPs go back to the pool, along with the host keys behind them
+	if _, err := sshlib.PruneKnownHosts(instanceIPs(targets)); err != nil {
+		return err
+	}
+
+	if wait {
+		ctx, cancel, waitOptions := waitFromFlags(cmd)
+		defer cancel()
+
+		if err := client.WaitForTermination(ctx, ids, waitOptions); err != nil {
+			return err
+		}
+		fmt.Println("All instances terminated.")
+	}
+
+	return nil
+}
+
+// Instances named by args and/or matching --filter, at least one of which is
+// required, leaving out any exclude matches. A name shared by several
+// instances only selects them all with --yes and --filter.
+func selectInstances(cmd *cobra.Command, client *api.APIClient, args []string, exclude func(api.InstanceDetails) bool) ([]api.InstanceDetails, error) {
+	yes, _ := cmd.Flags().GetBool("yes")
+
+	f, err := selectionFilter(cmd, args)
+	if err != nil {
+		return nil, err
+	}
+
+	instances, err := listInstances(cmd.Context(), client)
+	if err != nil {
+		return nil, err
+	}
+	if exclude != nil {
+		instances = slices.DeleteFunc(instances, exclude)
+	}
+	return selectFrom(instances, args, f, yes && len(f) > 0)
+}
+
+// Filter from --filter, erroring if neither it nor args select anything
+func selectionFilter(cmd *cobra.Command, args []string) (filter.Filter, error) {
+	f, err := filterFromFlags(cmd, api.IsInstanceField)
+	if err != nil {
+		return nil, err
+	}
+	if len(args) == 0 && len(f) == 0 {
+		return nil, errors.New("specify instances by ID or name, or select them with --filter")
+	}
+	return f, nil
+}
+
+// Instances named by args, or all of them, narrowed by f. Unless
+// allowShared, a name still matching several instances after f is an error.
+func selectFrom(instances []api.InstanceDetails, args []string, f filter.Filter, allowShared bool) ([]api.InstanceDetails, error) {
+	if len(args) > 0 {
+		var err error
+		if instances, err = resolveInstances(instances, args); err != nil {
+			return nil, err
+		}
+	}
+
+	instances = filter.Apply(f, instances)
+	if len(instances) == 0 {
+		return nil, errors.New("no instances match")
+	}
+
+	if !allowShared {
+		if err := checkSharedNames(instances, args); err != nil {
+			return nil, err
+		}
+	}
+	return instances, nil
+}
+
+// Names aren't unique, refuse to act on every instance behind one by accident
+func checkSharedNames(instances []api.InstanceDetails, args []string) error {
+	for _, arg := range args {
+		var matches []api.InstanceDetails
+		for _, instance := range instances {
+			if instance.Name == arg && instance.ID != arg {
+				matches = append(matches, instance)
+			}
+		}
+		if len(matches) > 1 {
+			return fmt.Errorf("name %q matches %d instances, name them by ID or narrow them with --filter:\n%s", arg, len(matches), describeInstances(matches))
+		}
+	}
+	return nil
+}
+
+// Match each argument against instance IDs first, then names
+func resolveInstances(instances []api.InstanceDetails, args []string) ([]api.InstanceDetails, error) {
+	var resolved []api.InstanceDetails
+	seen := map[string]bool{}
+	for _, arg := range args {
+		matched := false
+		for _, instance := range instances {
+			if instance.ID != arg && instance.Name != arg {
+				continue
+			}
+			matched = true
+			if !seen[instance.ID] {
+				seen[instance.ID] = true
+				resolved = append(resolved, instance)
+			}
+		}
+		if !matched {
+			return nil, fmt.Errorf("no instance with ID or name %q", arg)
+		}
+	}
+
+	return resolved, nil
+}
+
+func instanceIDs(instances []api.InstanceDetails) []string {
+	ids := make([]string, len(instances))
+	for i, instance := range instances {
+		ids[i] = instance.ID
+	}
+	return ids
+}
+
+// One line per instance, for confirmation prompts
+func describeInstances(instances []api.InstanceDetails) string {
+	lines := make([]string, len(instances))
+	for i, instance := range instances {
+		lines[i] = fmt.Sprintf("%s  %s  %s  %s", instance.ID, instance.Name, instance.InstanceType.Name, instance.Region.Name)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func confirm(title, description string) (bool, error) {
+	var ok bool
+	err := huh.NewConfirm().
+		Title(title).
+		Description(description).
+		Affirmative("Yes").
+		Negative("No").
+		Value(&ok).
+		Run()
+	return ok, err
+}
+
+func init() {
+	rootCmd.AddCommand(terminateCmd)
+
+	terminateCmd.Flags().BoolP("yes", "y", false, "Skip confirmation")
+	addFilterFlag(terminateCmd)
+	addWaitFlags(terminateCmd, "gone", 10*time.Minute)
+}
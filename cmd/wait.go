@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"lambdactl/pkg/api"
+
+	"github.com/spf13/cobra"
+)
+
+// Flags shared by commands that can block on instance state
+func addWaitFlags(cmd *cobra.Command, what string, timeout time.Duration) {
+	cmd.Flags().Bool("wait", false, "Wait until the instances are "+what)
+	cmd.Flags().Duration("timeout", timeout, "Give up waiting after this long")
+	cmd.Flags().Duration("poll-interval", api.DefaultPollInterval, "Time between status checks while waiting")
+}
+
+// Deadline-bound context and options for a wait, reporting progress on stderr
+func waitFromFlags(cmd *cobra.Command) (context.Context, context.CancelFunc, api.WaitOptions) {
+	timeout, _ := cmd.Flags().GetDuration("timeout")
+	interval, _ := cmd.Flags().GetDuration("poll-interval")
+
+	ctx, cancel := cmd.Context(), context.CancelFunc(func() {})
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	}
+
+	return ctx, cancel, api.WaitOptions{
+		Interval: interval,
+		Progress: printWaitEvent,
+	}
+}
+
+func printWaitEvent(event api.WaitEvent) {
+	name := event.Instance.Label()
+	status := event.Instance.Status
+	if status == "" {
+		status = "gone"
+	}
+
+	if event.PreviousStatus == "" {
+		fmt.Fprintf(os.Stderr, "[%d/%d] %s: %s\n", event.Ready, event.Total, name, status)
+	} else {
+		fmt.Fprintf(os.Stderr, "[%d/%d] %s: %s -> %s\n", event.Ready, event.Total, name, event.PreviousStatus, status)
+	}
+}
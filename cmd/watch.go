@@ -0,0 +1,259 @@
+package cmd
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"slices"
+	"time"
+
+	"lambdactl/pkg/api"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+const (
+	capacityAvailable = "available"
+	capacityGone      = "gone"
+)
+
+var watchCapacityCmd = &cobra.Command{
+	Use:   "watch-capacity",
+	Short: "Poll for instance capacity, notify when it appears and optionally launch",
+	Args:  cobra.NoArgs,
+	RunE:  watchCapacityFunc,
+}
+
+// Payload posted to webhooks, "text" makes it render in Slack-style receivers
+type capacityEvent struct {
+	Text              string    `json:"text"`
+	Event             string    `json:"event"`
+	Time              time.Time `json:"time"`
+	InstanceType      string    `json:"instance_type"`
+	Region            string    `json:"region"`
+	GPUDescription    string    `json:"gpu_description"`
+	PriceCentsPerHour int       `json:"price_cents_per_hour"`
+}
+
+// Instances launched so far against the caps
+type launchBudget struct {
+	maxInstances  int
+	maxSpendCents int // Per hour across everything launched, 0 for no cap
+	instances     int
+	spendCents    int
+}
+
+// Why launching has to stop, empty while one of candidates still fits
+func (b *launchBudget) stopReason(candidates []api.InstanceOption) string {
+	if b.instances >= b.maxInstances {
+		return fmt.Sprintf("Launch budget of %d instance(s) reached", b.maxInstances)
+	}
+	if b.maxSpendCents > 0 && len(candidates) > 0 {
+		cheapest := slices.MinFunc(candidates, func(a, b api.InstanceOption) int {
+			return cmp.Compare(a.Type.PriceCentsPerHour, b.Type.PriceCentsPerHour)
+		})
+		if left := b.maxSpendCents - b.spendCents; left < cheapest.Type.PriceCentsPerHour {
+			return fmt.Sprintf("Spend cap of $%s/hour reached, $%s/hour left is below the cheapest option", dollars(b.maxSpendCents), dollars(left))
+		}
+	}
+	return ""
+}
+
+// How many instances of option still fit, up to want
+func (b *launchBudget) fits(option api.InstanceOption, want int) int {
+	n := min(want, b.maxInstances-b.instances)
+	if b.maxSpendCents > 0 && option.Type.PriceCentsPerHour > 0 {
+		n = min(n, (b.maxSpendCents-b.spendCents)/option.Type.PriceCentsPerHour)
+	}
+	return max(n, 0)
+}
+
+func watchCapacityFunc(cmd *cobra.Command, args []string) error {
+	interval, _ := cmd.Flags().GetDuration("interval")
+	bell, _ := cmd.Flags().GetBool("bell")
+	webhooks, _ := cmd.Flags().GetStringSlice("webhook")
+	autoLaunch, _ := cmd.Flags().GetBool("launch")
+	count, _ := cmd.Flags().GetInt("count")
+	maxInstances, _ := cmd.Flags().GetInt("max-instances")
+	maxSpend, _ := cmd.Flags().GetFloat64("max-spend")
+	filesystems, _ := cmd.Flags().GetStringSlice("filesystem")
+
+	client, err := newAPIClient(cmd.Context())
+	if err != nil {
+		return err
+	}
+
+	criteria := criteriaFromFlags(cmd)
+	if criteria.Regions, err = filesystemRegions(cmd.Context(), client, criteria.Regions, filesystems); err != nil {
+		return err
+	}
+	criteria.Regions = regionsOrDefault(criteria.Regions)
+	if autoLaunch && criteria.IsEmpty() {
+		return errNoCriteria
+	}
+
+	budget := &launchBudget{
+		maxInstances:  maxInstances,
+		maxSpendCents: int(math.Round(maxSpend * 100)),
+	}
+
+	// Checked once up front rather than on every launch
+	var sshKeyNames []string
+	if autoLaunch {
+		if sshKeyNames, err = client.ValidateSSHKeyNames(cmd.Context(), viper.GetStringSlice("ssh-key-names")); err != nil {
+			return err
+		}
+	}
+
+	ctx := cmd.Context()
+	var previous []api.InstanceOption
+	polled := false
+	for {
+		options, err := client.FetchInstanceOptions(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			// Keep watching through transient failures, they already had retries
+			fmt.Fprintf(os.Stderr, "Error polling capacity: %v\n", err)
+		} else {
+			current := api.RankInstanceOptions(options, criteria)
+			appeared, gone := api.DiffInstanceOptions(previous, current)
+			previous = current
+
+			// What's already there is the baseline, only changes are news
+			if !polled {
+				polled = true
+				fmt.Fprintf(os.Stderr, "Watching capacity, %d matching option(s) available now\n", len(current))
+				appeared = nil
+			}
+
+			for _, option := range gone {
+				notifyCapacity(ctx, client.HTTPClient, capacityGone, option, false, nil)
+			}
+			for _, option := range appeared {
+				notifyCapacity(ctx, client.HTTPClient, capacityAvailable, option, bell, webhooks)
+			}
+
+			// Everything that matches, not just what appeared, so a lost race
+			// or failed launch is retried while the capacity stays listed
+			if autoLaunch && len(current) > 0 {
+				launchAvailable(ctx, client, current, count, api.LaunchOptions{
+					FilesystemNames: filesystems,
+					SSHKeyNames:     sshKeyNames,
+				}, budget)
+				if reason := budget.stopReason(current); reason != "" {
+					fmt.Fprintf(os.Stderr, "%s, stopping\n", reason)
+					return nil
+				}
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(interval):
+		}
+	}
+}
+
+// Launch from available options, best first, until the budget runs out
+func launchAvailable(ctx context.Context, client *api.APIClient, candidates []api.InstanceOption, count int, opts api.LaunchOptions, budget *launchBudget) {
+	for _, option := range candidates {
+		n := budget.fits(option, count)
+		if n == 0 {
+			continue
+		}
+
+		opts.Quantity = n
+		launched, err := client.LaunchInstances(ctx, option, opts)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to launch %s in %s: %v\n", option.Type.Name, option.Region, err)
+			continue
+		}
+
+		budget.instances += len(launched.InstanceIDs)
+		budget.spendCents += len(launched.InstanceIDs) * option.Type.PriceCentsPerHour
+		for _, id := range launched.InstanceIDs {
+			fmt.Printf("%s launched %s %s %s\n", time.Now().Format(time.RFC3339), option.Type.Name, option.Region, id)
+		}
+
+		if budget.stopReason(candidates) != "" {
+			return
+		}
+	}
+}
+
+// Report a capacity change on stdout, and on the bell and webhooks if given.
+// Webhooks go through httpClient, so they honour http-proxy and ca-bundle.
+func notifyCapacity(ctx context.Context, httpClient *http.Client, event string, option api.InstanceOption, bell bool, webhooks []string) {
+	now := time.Now()
+	text := fmt.Sprintf("%s %s %s ($%.2f/hour)", option.Type.Name, event, option.Region, float64(option.Type.PriceCentsPerHour)/100)
+	fmt.Printf("%s %s %s %s $%.2f/hour\n", now.Format(time.RFC3339), event, option.Type.Name, option.Region, float64(option.Type.PriceCentsPerHour)/100)
+
+	if bell {
+		fmt.Fprint(os.Stderr, "\a")
+	}
+
+	payload := capacityEvent{
+		Text:              text,
+		Event:             event,
+		Time:              now,
+		InstanceType:      option.Type.Name,
+		Region:            option.Region,
+		GPUDescription:    option.Type.GPUDescription,
+		PriceCentsPerHour: option.Type.PriceCentsPerHour,
+	}
+	for _, webhook := range webhooks {
+		if err := postWebhook(ctx, httpClient, webhook, payload); err != nil {
+			fmt.Fprintf(os.Stderr, "Webhook %s failed: %v\n", webhook, err)
+		}
+	}
+}
+
+func postWebhook(ctx context.Context, httpClient *http.Client, url string, payload any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("status %s", resp.Status)
+	}
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(watchCapacityCmd)
+
+	addCriteriaFlags(watchCapacityCmd)
+	watchCapacityCmd.Flags().Duration("interval", time.Minute, "Time between capacity checks")
+	watchCapacityCmd.Flags().Bool("bell", false, "Ring the terminal bell when capacity appears")
+	watchCapacityCmd.Flags().StringSlice("webhook", nil, "URL(s) to POST a JSON event to when capacity appears")
+	watchCapacityCmd.Flags().Bool("launch", false, "Launch instances as soon as matching capacity appears")
+	watchCapacityCmd.Flags().Int("count", 1, "Instances to launch per available option")
+	watchCapacityCmd.Flags().Int("max-instances", 1, "Stop after launching this many instances in total")
+	watchCapacityCmd.Flags().Float64("max-spend", 0, "Cap on the combined $/hour of launched instances")
+	watchCapacityCmd.Flags().StringSlice("filesystem", nil, "Filesystem(s) to attach to launched instances, by name")
+}
@@ -2,29 +2,41 @@ package api
 
 import (
 	"bytes"
+	"cmp"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
-	"math"
 	"net/http"
-
 	"slices"
-	"time"
-
-	"lambdactl/pkg/utils"
+	"strings"
 
 	"github.com/spf13/viper"
 )
 
-func NewAPIClient(baseURL, apiKey string) *APIClient {
-	return &APIClient{
+// Build a client for the API, with a reusable HTTP client tuned by opts
+func NewAPIClient(baseURL, apiKey string, opts ...ClientOption) (*APIClient, error) {
+	client := &APIClient{
 		BaseURL: baseURL,
 		APIKey:  apiKey,
+		HTTPClient: &http.Client{
+			Transport: http.DefaultTransport.(*http.Transport).Clone(),
+			Timeout:   DefaultTimeout,
+		},
+		RetryPolicy: DefaultRetryPolicy,
+	}
+
+	for _, opt := range opts {
+		if err := opt(client); err != nil {
+			return nil, err
+		}
 	}
+
+	return client, nil
 }
 
-func (c *APIClient) MakeRequest(method, endpoint string, body interface{}) ([]byte, error) {
+func (c *APIClient) MakeRequest(ctx context.Context, method, endpoint string, body interface{}) ([]byte, error) {
 	url := fmt.Sprintf("%s%s", c.BaseURL, endpoint)
 
 	var reqBody []byte
@@ -36,37 +48,56 @@ func (c *APIClient) MakeRequest(method, endpoint string, body interface{}) ([]by
 		}
 	}
 
-	req, err := http.NewRequest(method, url, bytes.NewBuffer(reqBody))
-	if err != nil {
-		return nil, err
-	}
+	idempotent := isIdempotent(method)
+	for attempt := 1; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(reqBody))
+		if err != nil {
+			return nil, err
+		}
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.APIKey))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.APIKey))
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
+		resp, err := c.HTTPClient.Do(req)
+		if err != nil {
+			if ctx.Err() != nil || attempt >= c.RetryPolicy.MaxAttempts || !retryableError(err, idempotent) {
+				return nil, err
+			}
+			if err := sleepContext(ctx, c.RetryPolicy.backoff(attempt)); err != nil {
+				return nil, err
+			}
+			continue
+		}
 
-	respBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
+		respBody, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("API request failed with status code %d: %s", resp.StatusCode, string(respBody))
-	}
+		if resp.StatusCode == http.StatusOK {
+			return respBody, nil
+		}
 
-	return respBody, nil
+		requestErr := newError(resp.StatusCode, respBody)
+		if attempt >= c.RetryPolicy.MaxAttempts || !retryableStatus(resp.StatusCode, idempotent) {
+			return nil, requestErr
+		}
+
+		delay, ok := c.RetryPolicy.retryAfter(resp.Header)
+		if !ok {
+			delay = c.RetryPolicy.backoff(attempt)
+		}
+		if err := sleepContext(ctx, delay); err != nil {
+			return nil, err
+		}
+	}
 }
 
-func (c *APIClient) FetchInstanceOptions() ([]InstanceOption, error) {
-	resp, err := c.MakeRequest("GET", "instance-types", nil)
+func (c *APIClient) FetchInstanceOptions(ctx context.Context) ([]InstanceOption, error) {
+	resp, err := c.MakeRequest(ctx, "GET", "instance-types", nil)
 	if err != nil {
-		return nil, fmt.Errorf("error retrieving instance types: %v", err)
+		return nil, fmt.Errorf("error retrieving instance types: %w", err)
 	}
 
 	var instanceTypes InstanceTypesResponse
@@ -89,11 +120,16 @@ func (c *APIClient) FetchInstanceOptions() ([]InstanceOption, error) {
 	return instanceOptions, nil
 }
 
-func (c *APIClient) LaunchInstances(instanceOption InstanceOption, quantity int) (InstanceLaunchData, error) {
-	var sshKeyNames []string
-	if err := viper.UnmarshalKey("ssh-key-names", &sshKeyNames); err != nil || sshKeyNames == nil {
-		sshKeyNames = []string{"AAP"} // Fallback key
+func (c *APIClient) LaunchInstances(ctx context.Context, instanceOption InstanceOption, launchOptions LaunchOptions) (InstanceLaunchData, error) {
+	sshKeyNames := launchOptions.SSHKeyNames
+	if len(sshKeyNames) == 0 {
+		var err error
+		sshKeyNames, err = c.ValidateSSHKeyNames(ctx, viper.GetStringSlice("ssh-key-names"))
+		if err != nil {
+			return InstanceLaunchData{}, err
+		}
 	}
+	quantity := launchOptions.Quantity
 	if quantity < 1 {
 		quantity = 1
 	}
@@ -104,10 +140,16 @@ func (c *APIClient) LaunchInstances(instanceOption InstanceOption, quantity int)
 		"ssh_key_names":      sshKeyNames,
 		"quantity":           quantity,
 	}
+	if launchOptions.Name != "" {
+		data["name"] = launchOptions.Name
+	}
+	if len(launchOptions.FilesystemNames) > 0 {
+		data["file_system_names"] = launchOptions.FilesystemNames
+	}
 
-	resp, err := c.MakeRequest("POST", "instance-operations/launch", data)
+	resp, err := c.MakeRequest(ctx, "POST", "instance-operations/launch", data)
 	if err != nil {
-		return InstanceLaunchData{}, fmt.Errorf("error launching instance(s): %v", err)
+		return InstanceLaunchData{}, fmt.Errorf("error launching instance(s): %w", err)
 	}
 
 	var launchResponse InstanceLaunchResponse
@@ -119,39 +161,56 @@ func (c *APIClient) LaunchInstances(instanceOption InstanceOption, quantity int)
 	return launchResponse.InstanceLaunches, nil
 }
 
-func (c *APIClient) WaitForInstances(instancesLaunched InstanceLaunchData) (map[string]InstanceDetails, error) {
-	var myInstances = map[string]InstanceDetails{}
-	for {
-		resp, err := c.MakeRequest("GET", "instances", nil)
-		if err != nil {
-			return nil, fmt.Errorf("failed to get instance details: %v", err)
-		}
+func (c *APIClient) TerminateInstances(ctx context.Context, ids []string) ([]InstanceDetails, error) {
+	if len(ids) == 0 {
+		return nil, errors.New("no instance IDs to terminate")
+	}
 
-		var allInstances InstanceListResponse
-		err = json.Unmarshal(resp, &allInstances)
-		if err != nil {
-			return nil, fmt.Errorf("failed to unmarshal API response: %v", err)
-		}
+	data := map[string]interface{}{
+		"instance_ids": ids,
+	}
 
-		for _, instance := range allInstances.InstanceList {
-			if slices.Contains(instancesLaunched.InstanceIDs, instance.ID) {
-				// One of mine
-				myInstances[instance.ID] = instance
-			}
-		}
+	resp, err := c.MakeRequest(ctx, "POST", "instance-operations/terminate", data)
+	if err != nil {
+		return nil, fmt.Errorf("error terminating instance(s): %w", err)
+	}
 
-		if utils.All(myInstances, func(v InstanceDetails) bool { return v.Status == "active" && v.IP != "" }) {
-			return myInstances, nil
-		}
+	var terminateResponse InstanceTerminateResponse
+	err = json.Unmarshal(resp, &terminateResponse)
+	if err != nil {
+		return nil, fmt.Errorf("error unmarshaling response data: %v", err)
+	}
+
+	return terminateResponse.InstanceTerminations.TerminatedInstances, nil
+}
 
-		time.Sleep(10 * time.Second)
+func (c *APIClient) RestartInstances(ctx context.Context, ids []string) ([]InstanceDetails, error) {
+	if len(ids) == 0 {
+		return nil, errors.New("no instance IDs to restart")
 	}
+
+	data := map[string]interface{}{
+		"instance_ids": ids,
+	}
+
+	resp, err := c.MakeRequest(ctx, "POST", "instance-operations/restart", data)
+	if err != nil {
+		return nil, fmt.Errorf("error restarting instance(s): %w", err)
+	}
+
+	var restartResponse InstanceRestartResponse
+	err = json.Unmarshal(resp, &restartResponse)
+	if err != nil {
+		return nil, fmt.Errorf("error unmarshaling response data: %v", err)
+	}
+
+	return restartResponse.InstanceRestarts.RestartedInstances, nil
 }
 
-func (c *APIClient) ListInstances() ([]InstanceDetails, error) {
-	resp, err := c.MakeRequest("GET", "instances", nil)
+func (c *APIClient) ListInstances(ctx context.Context) ([]InstanceDetails, error) {
+	resp, err := c.MakeRequest(ctx, "GET", "instances", nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get instance details: %v", err)
+		return nil, fmt.Errorf("failed to get instance details: %w", err)
 	}
 
 	var listResponse InstanceListResponse
@@ -163,34 +222,288 @@ func (c *APIClient) ListInstances() ([]InstanceDetails, error) {
 	return listResponse.InstanceList, nil
 }
 
-func SelectBestInstanceOption(options []InstanceOption, requested InstanceOption) (InstanceOption, error) {
-	var bestOption InstanceOption
-	lowestCost := math.MaxInt
+// How to refer to an instance, names aren't required so fall back to the ID
+func (i InstanceDetails) Label() string {
+	if i.Name != "" {
+		return i.Name
+	}
+	return i.ID
+}
+
+// Terminated and preempted instances are gone for good
+func IsGone(status string) bool {
+	return status == StatusTerminated || status == StatusPreempted
+}
 
-	// Check if the options meet the minimum requirements
-	for _, option := range options {
-		// Check type name if specified
-		if requested.Type.Name != "" && option.Type.Name != requested.Type.Name {
-			continue
+// IPs of gone instances that no other listed instance holds. Lambda hands
+// released IPs to new instances, so their host keys shouldn't be trusted.
+func ReleasedIPs(instances []InstanceDetails) []string {
+	live := map[string]bool{}
+	for _, instance := range instances {
+		if !IsGone(instance.Status) {
+			live[instance.IP], live[instance.PrivateIP] = true, true
 		}
+	}
 
-		// Check region if specified
-		if requested.Region != "" && option.Region != requested.Region {
+	var ips []string
+	for _, instance := range instances {
+		if !IsGone(instance.Status) {
 			continue
 		}
+		for _, ip := range []string{instance.IP, instance.PrivateIP} {
+			if ip != "" && !live[ip] {
+				ips = append(ips, ip)
+			}
+		}
+	}
+	return ips
+}
 
-		// TODO: Add additional filters
+func (c *APIClient) ListSSHKeys(ctx context.Context) ([]SSHKey, error) {
+	resp, err := c.MakeRequest(ctx, "GET", "ssh-keys", nil)
+	if err != nil {
+		return nil, fmt.Errorf("error listing SSH keys: %w", err)
+	}
 
-		// If we've made it here, the option is valid. Check if it's the best so far.
-		if option.Type.PriceCentsPerHour < lowestCost {
-			lowestCost = option.Type.PriceCentsPerHour
-			bestOption = option
+	var listResponse SSHKeyListResponse
+	err = json.Unmarshal(resp, &listResponse)
+	if err != nil {
+		return nil, fmt.Errorf("error unmarshaling response data: %v", err)
+	}
+
+	return listResponse.SSHKeys, nil
+}
+
+// Upload an existing public key, or generate a new pair if publicKey is empty
+func (c *APIClient) AddSSHKey(ctx context.Context, name, publicKey string) (SSHKey, error) {
+	data := map[string]interface{}{
+		"name": name,
+	}
+	if publicKey != "" {
+		data["public_key"] = publicKey
+	}
+
+	resp, err := c.MakeRequest(ctx, "POST", "ssh-keys", data)
+	if err != nil {
+		return SSHKey{}, fmt.Errorf("error adding SSH key: %w", err)
+	}
+
+	var keyResponse SSHKeyResponse
+	err = json.Unmarshal(resp, &keyResponse)
+	if err != nil {
+		return SSHKey{}, fmt.Errorf("error unmarshaling response data: %v", err)
+	}
+
+	return keyResponse.SSHKey, nil
+}
+
+// Have the API generate a key pair; the private key is only returned this once
+func (c *APIClient) GenerateSSHKey(ctx context.Context, name string) (SSHKey, error) {
+	return c.AddSSHKey(ctx, name, "")
+}
+
+func (c *APIClient) DeleteSSHKey(ctx context.Context, id string) error {
+	if _, err := c.MakeRequest(ctx, "DELETE", "ssh-keys/"+id, nil); err != nil {
+		return fmt.Errorf("error deleting SSH key: %w", err)
+	}
+	return nil
+}
+
+func (c *APIClient) ListFilesystems(ctx context.Context) ([]Filesystem, error) {
+	resp, err := c.MakeRequest(ctx, "GET", "file-systems", nil)
+	if err != nil {
+		return nil, fmt.Errorf("error listing filesystems: %w", err)
+	}
+
+	var listResponse FilesystemListResponse
+	err = json.Unmarshal(resp, &listResponse)
+	if err != nil {
+		return nil, fmt.Errorf("error unmarshaling response data: %v", err)
+	}
+
+	return listResponse.Filesystems, nil
+}
+
+func (c *APIClient) CreateFilesystem(ctx context.Context, name, region string) (Filesystem, error) {
+	data := map[string]interface{}{
+		"name":   name,
+		"region": region,
+	}
+
+	resp, err := c.MakeRequest(ctx, "POST", "filesystems", data)
+	if err != nil {
+		return Filesystem{}, fmt.Errorf("error creating filesystem: %w", err)
+	}
+
+	var fsResponse FilesystemResponse
+	err = json.Unmarshal(resp, &fsResponse)
+	if err != nil {
+		return Filesystem{}, fmt.Errorf("error unmarshaling response data: %v", err)
+	}
+
+	return fsResponse.Filesystem, nil
+}
+
+func (c *APIClient) DeleteFilesystem(ctx context.Context, id string) error {
+	if _, err := c.MakeRequest(ctx, "DELETE", "filesystems/"+id, nil); err != nil {
+		return fmt.Errorf("error deleting filesystem: %w", err)
+	}
+	return nil
+}
+
+// Check the requested key names exist on the account, so launches don't fail late
+func (c *APIClient) ValidateSSHKeyNames(ctx context.Context, names []string) ([]string, error) {
+	keys, err := c.ListSSHKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	available := make([]string, len(keys))
+	for i, key := range keys {
+		available[i] = key.Name
+	}
+
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no ssh-key-names configured; keys on this account: %v", available)
+	}
+
+	var missing []string
+	for _, name := range names {
+		if !slices.Contains(available, name) {
+			missing = append(missing, name)
 		}
 	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("SSH key(s) %v not found on this account; available: %v", missing, available)
+	}
 
-	if bestOption.Type.Name == "" {
+	return names, nil
+}
+
+// Try each candidate in order until one has capacity, calling onSkip for those that don't
+func (c *APIClient) LaunchFirstAvailable(ctx context.Context, candidates []InstanceOption, launchOptions LaunchOptions, onSkip func(InstanceOption, error)) (InstanceOption, InstanceLaunchData, error) {
+	if len(candidates) == 0 {
+		return InstanceOption{}, InstanceLaunchData{}, errors.New("no suitable GPU option found")
+	}
+
+	// Once, rather than again for every candidate
+	if len(launchOptions.SSHKeyNames) == 0 {
+		sshKeyNames, err := c.ValidateSSHKeyNames(ctx, viper.GetStringSlice("ssh-key-names"))
+		if err != nil {
+			return InstanceOption{}, InstanceLaunchData{}, err
+		}
+		launchOptions.SSHKeyNames = sshKeyNames
+	}
+
+	var lastErr error
+	for _, candidate := range candidates {
+		launched, err := c.LaunchInstances(ctx, candidate, launchOptions)
+		if err == nil {
+			return candidate, launched, nil
+		}
+		if !IsCapacityError(err) {
+			return candidate, InstanceLaunchData{}, err
+		}
+
+		lastErr = err
+		if onSkip != nil {
+			onSkip(candidate, err)
+		}
+	}
+
+	return InstanceOption{}, InstanceLaunchData{}, fmt.Errorf("no capacity in any of %d candidate(s): %w", len(candidates), lastErr)
+}
+
+func (c InstanceCriteria) IsEmpty() bool {
+	return len(c.Types) == 0 && len(c.Regions) == 0 && c.MinGPUs == 0 && c.GPUModel == "" &&
+		c.MinVCPUs == 0 && c.MinMemoryGiB == 0 && c.MinStorageGiB == 0 && c.MaxPriceCents == 0
+}
+
+// Whether an option satisfies every criterion that is set
+func (c InstanceCriteria) Matches(option InstanceOption) bool {
+	if len(c.Types) > 0 && !slices.Contains(c.Types, option.Type.Name) {
+		return false
+	}
+	if len(c.Regions) > 0 && !slices.Contains(c.Regions, option.Region) {
+		return false
+	}
+
+	specs := option.Type.Specs
+	if specs.GPUs < c.MinGPUs || specs.VCPUs < c.MinVCPUs || specs.MemoryGiB < c.MinMemoryGiB || specs.StorageGiB < c.MinStorageGiB {
+		return false
+	}
+	if c.GPUModel != "" && !strings.Contains(strings.ToLower(option.Type.GPUDescription), strings.ToLower(c.GPUModel)) {
+		return false
+	}
+	if c.MaxPriceCents > 0 && option.Type.PriceCentsPerHour > c.MaxPriceCents {
+		return false
+	}
+
+	return true
+}
+
+// Options matching criteria, best first: preferred type, then preferred region, then price
+func RankInstanceOptions(options []InstanceOption, criteria InstanceCriteria) []InstanceOption {
+	ranked := []InstanceOption{}
+	for _, option := range options {
+		if criteria.Matches(option) {
+			ranked = append(ranked, option)
+		}
+	}
+
+	slices.SortStableFunc(ranked, func(a, b InstanceOption) int {
+		return cmp.Or(
+			cmp.Compare(preference(criteria.Types, a.Type.Name), preference(criteria.Types, b.Type.Name)),
+			cmp.Compare(preference(criteria.Regions, a.Region), preference(criteria.Regions, b.Region)),
+			cmp.Compare(a.Type.PriceCentsPerHour, b.Type.PriceCentsPerHour),
+			cmp.Compare(a.Type.Name, b.Type.Name),
+			cmp.Compare(a.Region, b.Region),
+		)
+	})
+
+	return ranked
+}
+
+// Cheapest option meeting the criteria, honoring preference order
+func SelectBestInstanceOption(options []InstanceOption, criteria InstanceCriteria) (InstanceOption, error) {
+	ranked := RankInstanceOptions(options, criteria)
+	if len(ranked) == 0 {
 		return InstanceOption{}, errors.New("no suitable GPU option found")
 	}
 
-	return bestOption, nil
+	return ranked[0], nil
+}
+
+// Options present in current but not previous, and the other way around
+func DiffInstanceOptions(previous, current []InstanceOption) (appeared, gone []InstanceOption) {
+	key := func(option InstanceOption) string {
+		return option.Type.Name + "/" + option.Region
+	}
+
+	before := map[string]bool{}
+	for _, option := range previous {
+		before[key(option)] = true
+	}
+	after := map[string]bool{}
+	for _, option := range current {
+		after[key(option)] = true
+		if !before[key(option)] {
+			appeared = append(appeared, option)
+		}
+	}
+	for _, option := range previous {
+		if !after[key(option)] {
+			gone = append(gone, option)
+		}
+	}
+
+	return appeared, gone
+}
+
+// Position in an ordered preference list, where unlisted sorts last
+func preference(list []string, value string) int {
+	if index := slices.Index(list, value); index >= 0 {
+		return index
+	}
+	return len(list)
 }
@@ -0,0 +1,107 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// Error codes returned in the API's error envelope
+const (
+	CodeUnknown                 = "global/unknown"
+	CodeInvalidAPIKey           = "global/invalid-api-key"
+	CodeAccountInactive         = "global/account-inactive"
+	CodeInvalidAddress          = "global/invalid-address"
+	CodeInvalidParameters       = "global/invalid-parameters"
+	CodeNotFound                = "global/object-does-not-exist"
+	CodeQuotaExceeded           = "global/quota-exceeded"
+	CodeInsufficientCapacity    = "instance-operations/launch/insufficient-capacity"
+	CodeFilesystemWrongRegion   = "instance-operations/launch/file-system-in-wrong-region"
+	CodeFilesystemsNotSupported = "instance-operations/launch/file-systems-not-supported"
+	CodeSSHKeyInUse             = "ssh-keys/key-in-use"
+)
+
+// A failed API request, decoded from the error envelope when there is one
+type Error struct {
+	StatusCode int    `json:"-" yaml:"StatusCode"`
+	Code       string `json:"code" yaml:"Code"`
+	Message    string `json:"message" yaml:"Message"`
+	Suggestion string `json:"suggestion,omitempty" yaml:"Suggestion,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Decode the error envelope, falling back to the raw body for non-JSON errors
+func newError(statusCode int, body []byte) *Error {
+	var envelope ErrorResponse
+	if err := json.Unmarshal(body, &envelope); err == nil && envelope.Error.Message != "" {
+		envelope.Error.StatusCode = statusCode
+		return &envelope.Error
+	}
+
+	message := strings.TrimSpace(string(body))
+	if message == "" || strings.HasPrefix(message, "<") {
+		message = http.StatusText(statusCode)
+	}
+
+	return &Error{
+		StatusCode: statusCode,
+		Code:       CodeUnknown,
+		Message:    message,
+	}
+}
+
+// Suggestion attached to an API error anywhere in err's chain, if any
+func Suggestion(err error) string {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return apiErr.Suggestion
+	}
+	return ""
+}
+
+// No capacity for the requested type in the requested region
+func IsCapacityError(err error) bool {
+	return hasCode(err, CodeInsufficientCapacity)
+}
+
+// Missing, invalid or disabled credentials
+func IsAuthError(err error) bool {
+	var apiErr *Error
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	return apiErr.Code == CodeInvalidAPIKey ||
+		apiErr.Code == CodeAccountInactive ||
+		apiErr.StatusCode == http.StatusUnauthorized ||
+		apiErr.StatusCode == http.StatusForbidden
+}
+
+func IsQuotaError(err error) bool {
+	return hasCode(err, CodeQuotaExceeded)
+}
+
+func IsNotFoundError(err error) bool {
+	var apiErr *Error
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	return apiErr.Code == CodeNotFound || apiErr.StatusCode == http.StatusNotFound
+}
+
+func IsRateLimitError(err error) bool {
+	var apiErr *Error
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusTooManyRequests
+}
+
+func IsInvalidParametersError(err error) bool {
+	return hasCode(err, CodeInvalidParameters)
+}
+
+func hasCode(err error, code string) bool {
+	var apiErr *Error
+	return errors.As(err, &apiErr) && apiErr.Code == code
+}
@@ -0,0 +1,83 @@
+package api
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Keys InstanceDetails.Field understands
+var InstanceFields = []string{
+	"id", "name", "status", "region", "type", "gpu", "gpus", "vcpus", "memory", "storage",
+	"price", "ip", "private-ip", "hostname", "filesystem", "ssh-key",
+}
+
+// Keys InstanceOption.Field understands
+var OptionFields = []string{
+	"region", "type", "gpu", "gpus", "vcpus", "memory", "storage", "price",
+}
+
+// Named fields for filtering, price is in $/hour, sizes in GiB and tag.<key> reads tags
+func (i InstanceDetails) Field(name string) (string, bool) {
+	switch name {
+	case "id":
+		return i.ID, true
+	case "name":
+		return i.Name, true
+	case "status":
+		return i.Status, true
+	case "region":
+		return i.Region.Name, true
+	case "ip":
+		return i.IP, true
+	case "private-ip":
+		return i.PrivateIP, true
+	case "hostname":
+		return i.Hostname, true
+	case "filesystem":
+		return strings.Join(i.Filesystems, ","), true
+	case "ssh-key":
+		return strings.Join(i.SSHKeys, ","), true
+	}
+	if key, ok := strings.CutPrefix(name, "tag."); ok {
+		value, found := i.Tags[key]
+		return value, found
+	}
+	return i.InstanceType.field(name)
+}
+
+func (o InstanceOption) Field(name string) (string, bool) {
+	if name == "region" {
+		return o.Region, true
+	}
+	return o.Type.field(name)
+}
+
+func (t InstanceType) field(name string) (string, bool) {
+	switch name {
+	case "type":
+		return t.Name, true
+	case "gpu":
+		return t.GPUDescription, true
+	case "gpus":
+		return strconv.Itoa(t.Specs.GPUs), true
+	case "vcpus":
+		return strconv.Itoa(t.Specs.VCPUs), true
+	case "memory":
+		return strconv.Itoa(t.Specs.MemoryGiB), true
+	case "storage":
+		return strconv.Itoa(t.Specs.StorageGiB), true
+	case "price":
+		return strconv.FormatFloat(float64(t.PriceCentsPerHour)/100, 'f', 2, 64), true
+	}
+	return "", false
+}
+
+// Known fields, plus tag.<key> for any key
+func IsInstanceField(name string) bool {
+	return slices.Contains(InstanceFields, name) || (strings.HasPrefix(name, "tag.") && len(name) > len("tag."))
+}
+
+func IsOptionField(name string) bool {
+	return slices.Contains(OptionFields, name)
+}
@@ -0,0 +1,121 @@
+package api
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// Lambda Cloud API, used when api-url isn't configured
+const DefaultBaseURL = "https://cloud.lambdalabs.com/api/v1/"
+
+// Applied when no timeout is configured, so a hung request can't block forever
+const DefaultTimeout = 30 * time.Second
+
+// Overall per-request timeout, including reading the body. Zero disables it.
+func WithTimeout(timeout time.Duration) ClientOption {
+	return func(c *APIClient) error {
+		c.HTTPClient.Timeout = timeout
+		return nil
+	}
+}
+
+// Route requests through an HTTP(S) proxy instead of the environment's
+func WithProxy(proxyURL string) ClientOption {
+	return func(c *APIClient) error {
+		u, err := url.Parse(proxyURL)
+		if err != nil {
+			return fmt.Errorf("invalid proxy URL %q: %v", proxyURL, err)
+		}
+
+		transport, err := c.transport()
+		if err != nil {
+			return err
+		}
+		transport.Proxy = http.ProxyURL(u)
+		return nil
+	}
+}
+
+// Trust the PEM certificates in caFile in addition to the system roots
+func WithCABundle(caFile string) ClientOption {
+	return func(c *APIClient) error {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return fmt.Errorf("failed to read CA bundle: %v", err)
+		}
+
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in CA bundle %s", caFile)
+		}
+
+		transport, err := c.transport()
+		if err != nil {
+			return err
+		}
+		if transport.TLSClientConfig == nil {
+			transport.TLSClientConfig = &tls.Config{}
+		}
+		transport.TLSClientConfig.RootCAs = pool
+		return nil
+	}
+}
+
+// Replace the HTTP client entirely, e.g. for tests or custom transports
+func WithHTTPClient(httpClient *http.Client) ClientOption {
+	return func(c *APIClient) error {
+		if httpClient == nil {
+			return errors.New("nil HTTP client")
+		}
+		c.HTTPClient = httpClient
+		return nil
+	}
+}
+
+// Options from the http-timeout, http-proxy, ca-bundle and retry.* config keys
+func ConfigOptions() []ClientOption {
+	var opts []ClientOption
+
+	if viper.IsSet("http-timeout") {
+		opts = append(opts, WithTimeout(viper.GetDuration("http-timeout")))
+	}
+	if proxyURL := viper.GetString("http-proxy"); proxyURL != "" {
+		opts = append(opts, WithProxy(proxyURL))
+	}
+	if caFile := viper.GetString("ca-bundle"); caFile != "" {
+		opts = append(opts, WithCABundle(os.ExpandEnv(caFile)))
+	}
+
+	policy := DefaultRetryPolicy
+	if viper.IsSet("retry.max-attempts") {
+		policy.MaxAttempts = viper.GetInt("retry.max-attempts")
+	}
+	if viper.IsSet("retry.base-delay") {
+		policy.BaseDelay = viper.GetDuration("retry.base-delay")
+	}
+	if viper.IsSet("retry.max-delay") {
+		policy.MaxDelay = viper.GetDuration("retry.max-delay")
+	}
+	opts = append(opts, WithRetryPolicy(policy))
+
+	return opts
+}
+
+func (c *APIClient) transport() (*http.Transport, error) {
+	transport, ok := c.HTTPClient.Transport.(*http.Transport)
+	if !ok {
+		return nil, errors.New("HTTP client transport is not an *http.Transport")
+	}
+	return transport, nil
+}
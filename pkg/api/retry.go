@@ -0,0 +1,112 @@
+package api
+
+import (
+	"errors"
+	"math"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// How MakeRequest retries failed requests
+type RetryPolicy struct {
+	MaxAttempts int           // Total attempts including the first, 1 disables retries
+	BaseDelay   time.Duration // Backoff before the first retry, doubled on each one after
+	MaxDelay    time.Duration // Cap on any single wait, including Retry-After, 0 for no cap
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 4,
+	BaseDelay:   500 * time.Millisecond,
+	MaxDelay:    30 * time.Second,
+}
+
+func WithRetryPolicy(policy RetryPolicy) ClientOption {
+	return func(c *APIClient) error {
+		if policy.MaxAttempts < 1 {
+			policy.MaxAttempts = 1
+		}
+		c.RetryPolicy = policy
+		return nil
+	}
+}
+
+// Exponential backoff with equal jitter, so bursts of clients spread out
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	shift := min(attempt-1, 30)
+	delay := time.Duration(math.MaxInt64)
+	if p.BaseDelay <= delay>>shift {
+		delay = p.BaseDelay << shift
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+	half := delay / 2
+	return half + rand.N(half+1)
+}
+
+// Wait requested by the server via Retry-After, in seconds or as an HTTP date
+func (p RetryPolicy) retryAfter(header http.Header) (time.Duration, bool) {
+	value := header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+
+	var delay time.Duration
+	if seconds, err := strconv.Atoi(value); err == nil {
+		delay = time.Duration(seconds) * time.Second
+	} else if date, err := http.ParseTime(value); err == nil {
+		delay = time.Until(date)
+	} else {
+		return 0, false
+	}
+
+	if delay < 0 {
+		delay = 0
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	return delay, true
+}
+
+// Repeating these has the same effect as sending them once
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// Whether a response status is worth another attempt. Rate limiting rejects the
+// request before it is processed, so it's safe for any method; server errors
+// may have happened after the fact, so only idempotent requests retry those.
+func retryableStatus(status int, idempotent bool) bool {
+	switch status {
+	case http.StatusTooManyRequests:
+		return true
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return idempotent
+	}
+	return false
+}
+
+// Whether a transport error is worth another attempt. Failing to connect means
+// the request never left, otherwise only idempotent requests are safe to resend.
+func retryableError(err error, idempotent bool) bool {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return true
+	}
+	return idempotent
+}
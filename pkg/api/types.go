@@ -1,5 +1,17 @@
 package api
 
+import "net/http"
+
+// Instance lifecycle states reported by the API
+const (
+	StatusBooting     = "booting"
+	StatusActive      = "active"
+	StatusUnhealthy   = "unhealthy"
+	StatusTerminating = "terminating"
+	StatusTerminated  = "terminated"
+	StatusPreempted   = "preempted"
+)
+
 type InstanceSpecs struct {
 	GPUs       int `json:"gpus" yaml:"GPUs"`
 	MemoryGiB  int `json:"memory_gib" yaml:"MemoryGiB"`
@@ -49,18 +61,105 @@ type InstanceDetails struct {
 	Region       Region       `json:"region" yaml:"Region"`
 	SSHKeys      []string     `json:"ssh_key_names" yaml:"SSHKeys"`
 	Status       string       `json:"status" yaml:"Status"`
+
+	// Local labels from the tag store, never sent by the API
+	Tags map[string]string `json:"tags,omitempty" yaml:"Tags,omitempty"`
+}
+
+type InstanceTerminateData struct {
+	TerminatedInstances []InstanceDetails `json:"terminated_instances" yaml:"TerminatedInstances"`
+}
+
+type InstanceTerminateResponse struct {
+	InstanceTerminations InstanceTerminateData `json:"data" yaml:"InstanceTerminations"`
+}
+
+type InstanceRestartData struct {
+	RestartedInstances []InstanceDetails `json:"restarted_instances" yaml:"RestartedInstances"`
+}
+
+type InstanceRestartResponse struct {
+	InstanceRestarts InstanceRestartData `json:"data" yaml:"InstanceRestarts"`
 }
 
 type InstanceListResponse struct {
 	InstanceList []InstanceDetails `json:"data" yaml:"InstanceList"`
 }
 
+type SSHKey struct {
+	ID         string `json:"id" yaml:"ID"`
+	Name       string `json:"name" yaml:"Name"`
+	PublicKey  string `json:"public_key" yaml:"PublicKey"`
+	PrivateKey string `json:"private_key,omitempty" yaml:"PrivateKey,omitempty"` // Only set on generate
+}
+
+type SSHKeyListResponse struct {
+	SSHKeys []SSHKey `json:"data" yaml:"SSHKeys"`
+}
+
+type SSHKeyResponse struct {
+	SSHKey SSHKey `json:"data" yaml:"SSHKey"`
+}
+
+type User struct {
+	Email  string `json:"email" yaml:"Email"`
+	ID     string `json:"id" yaml:"ID"`
+	Status string `json:"status" yaml:"Status"`
+}
+
+type Filesystem struct {
+	BytesUsed  int64  `json:"bytes_used" yaml:"BytesUsed"`
+	Created    string `json:"created" yaml:"Created"`
+	CreatedBy  User   `json:"created_by" yaml:"CreatedBy"`
+	ID         string `json:"id" yaml:"ID"`
+	IsInUse    bool   `json:"is_in_use" yaml:"IsInUse"`
+	MountPoint string `json:"mount_point" yaml:"MountPoint"`
+	Name       string `json:"name" yaml:"Name"`
+	Region     Region `json:"region" yaml:"Region"`
+}
+
+type FilesystemListResponse struct {
+	Filesystems []Filesystem `json:"data" yaml:"Filesystems"`
+}
+
+type FilesystemResponse struct {
+	Filesystem Filesystem `json:"data" yaml:"Filesystem"`
+}
+
+type LaunchOptions struct {
+	Quantity        int      // Default 1
+	Name            string   // Shared by every instance in this launch
+	FilesystemNames []string // Attached at launch, must be in the same region
+	SSHKeyNames     []string // Already validated, default ssh-key-names checked against the account
+}
+
+type ErrorResponse struct {
+	Error Error `json:"error" yaml:"Error"`
+}
+
+// What a launch will accept. Zero values don't constrain.
+type InstanceCriteria struct {
+	Types         []string // Acceptable type names, most preferred first
+	Regions       []string // Acceptable regions, most preferred first
+	MinGPUs       int
+	GPUModel      string // Case-insensitive substring of the GPU description
+	MinVCPUs      int
+	MinMemoryGiB  int
+	MinStorageGiB int
+	MaxPriceCents int // Per hour
+}
+
 type InstanceOption struct {
-	Region string       `yaml:"Region"`
-	Type   InstanceType `yaml:"Type"`
+	Region string       `json:"region" yaml:"Region"`
+	Type   InstanceType `json:"instance_type" yaml:"Type"`
 }
 
 type APIClient struct {
-	BaseURL string
-	APIKey  string
+	BaseURL     string
+	APIKey      string
+	HTTPClient  *http.Client // Reused across requests
+	RetryPolicy RetryPolicy
 }
+
+// Configures an APIClient at construction
+type ClientOption func(*APIClient) error
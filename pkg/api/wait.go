@@ -0,0 +1,158 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"lambdactl/pkg/utils"
+)
+
+// Polling used when WaitOptions leaves it unset
+const DefaultPollInterval = 10 * time.Second
+
+// Tunes WaitForInstances and WaitForTermination. The deadline comes from ctx.
+type WaitOptions struct {
+	Interval time.Duration   // Between polls, default DefaultPollInterval
+	Progress func(WaitEvent) // Called on every status transition, may be nil
+}
+
+// A status transition seen while waiting
+type WaitEvent struct {
+	Instance       InstanceDetails // Latest details, Status is empty once it's gone
+	PreviousStatus string          // Empty the first time an instance is seen
+	Ready          int             // Instances that reached the target state
+	Total          int
+}
+
+// An instance entered a state it won't come back from while waiting for it
+type InstanceStatusError struct {
+	Instance InstanceDetails
+}
+
+func (e *InstanceStatusError) Error() string {
+	status := e.Instance.Status
+	if status == "" {
+		status = "gone"
+	}
+	return fmt.Sprintf("instance %s is %s", e.Instance.Label(), status)
+}
+
+// Block until all instances are active with an IP, failing early if any of
+// them goes unhealthy or away
+func (c *APIClient) WaitForInstances(ctx context.Context, ids []string, opts WaitOptions) (map[string]InstanceDetails, error) {
+	ready := func(instance InstanceDetails, found bool) bool {
+		return found && instance.Status == StatusActive && instance.IP != ""
+	}
+	// Only asked about unlisted instances once they were seen, so dropping
+	// out of the list is as final as being terminated
+	failed := func(instance InstanceDetails, found bool) bool {
+		return !found || slices.Contains([]string{StatusUnhealthy, StatusTerminating, StatusTerminated, StatusPreempted}, instance.Status)
+	}
+
+	return c.waitFor(ctx, ids, opts, ready, failed)
+}
+
+// Block until none of the instances are listed anymore, or they're all marked terminated
+func (c *APIClient) WaitForTermination(ctx context.Context, ids []string, opts WaitOptions) error {
+	ready := func(instance InstanceDetails, found bool) bool {
+		return !found || instance.Status == StatusTerminated
+	}
+	failed := func(instance InstanceDetails, found bool) bool {
+		return false
+	}
+
+	_, err := c.waitFor(ctx, ids, opts, ready, failed)
+	return err
+}
+
+// Poll the instance list until every ID is ready, reporting transitions as they happen
+func (c *APIClient) waitFor(ctx context.Context, ids []string, opts WaitOptions, ready, failed func(InstanceDetails, bool) bool) (map[string]InstanceDetails, error) {
+	interval := opts.Interval
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+
+	const gone = "gone"
+	statuses := map[string]string{}
+	latest := map[string]InstanceDetails{}
+	for {
+		instances, err := c.ListInstances(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		current := map[string]InstanceDetails{}
+		for _, instance := range instances {
+			if slices.Contains(ids, instance.ID) {
+				current[instance.ID] = instance
+			}
+		}
+
+		done := map[string]bool{}
+		for _, id := range ids {
+			instance, found := current[id]
+			done[id] = ready(instance, found)
+		}
+		readyCount := 0
+		for _, ok := range done {
+			if ok {
+				readyCount++
+			}
+		}
+
+		for _, id := range ids {
+			instance, found := current[id]
+			status := instance.Status
+			if !found {
+				// Not listed yet right after launch, or not anymore after termination
+				if _, seen := statuses[id]; !seen && !done[id] {
+					continue
+				}
+				instance = latest[id]
+				instance.ID = id
+				instance.Status = ""
+				status = gone
+			}
+
+			latest[id] = instance
+			if previous, seen := statuses[id]; !seen || previous != status {
+				statuses[id] = status
+				if opts.Progress != nil {
+					opts.Progress(WaitEvent{
+						Instance:       instance,
+						PreviousStatus: previous,
+						Ready:          readyCount,
+						Total:          len(ids),
+					})
+				}
+			}
+
+			if failed(instance, found) {
+				return latest, &InstanceStatusError{Instance: instance}
+			}
+		}
+
+		if utils.All(done, func(ok bool) bool { return ok }) {
+			return latest, nil
+		}
+
+		if err := sleepContext(ctx, interval); err != nil {
+			return latest, err
+		}
+	}
+}
+
+// Sleep for d, or until ctx is done
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,273 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Key holding the profiles, each a map of Profile keys
+const ProfilesKey = "profiles"
+
+// Keys from before the schema and what replaced them, as viper lowercases them
+var Legacy = map[string]string{
+	"apiurl": "api-url",
+	"apikey": "api-key",
+}
+
+var Keys = []Key{
+	{Name: "api-url", Kind: URLKind, Description: "Lambda Cloud API base URL", Profile: true},
+	{Name: "api-key", Kind: SecretKind, Description: "Lambda Cloud API key", Profile: true},
+	{Name: "api-key-command", Kind: StringKind, Description: "Shell command printing the API key, used when api-key isn't set", Profile: true},
+	{Name: "api-key-file", Kind: PathKind, Description: "File holding the API key, used when api-key and api-key-command aren't set", Profile: true},
+	{Name: "api-key-keyring", Kind: StringKind, Description: "Keyring account holding the API key, used when no other source is set", Profile: true},
+	{Name: "keyring-backend", Kind: StringKind, Description: "Keyring to use: auto, secret-service, macos or file"},
+	{Name: "keyring-file", Kind: PathKind, Description: "File used by the file keyring backend"},
+	{Name: "profile", Kind: StringKind, Description: "Profile used when --profile and LAMBDA_PROFILE aren't set"},
+	{Name: "region", Kind: StringKind, Description: "Default region for launch, watch-capacity and fs create", Profile: true},
+	{Name: "ssh-key-names", Kind: StringListKind, Description: "Account SSH key names added to launched instances", Profile: true},
+	{Name: "ssh-user", Kind: StringKind, Description: "User for SSH connections", Profile: true},
+	{Name: "ssh-key-file", Kind: PathKind, Description: "Private key for SSH, absolute or relative to ~/.ssh", Profile: true},
+	{Name: "known-hosts-file", Kind: PathKind, Description: "Where lambdactl records SSH host keys"},
+	{Name: "ssh-key-files", Kind: StringListKind, Description: "More private keys to try after ssh-key-file", Profile: true},
+	{Name: "ssh-auth", Kind: StringListKind, Description: "SSH auth methods in order: agent, keys", Profile: true},
+	{Name: "ssh-jump", Kind: StringKind, Description: "Jump hosts for SSH, [user@]host[:port] separated by commas", Profile: true},
+	{Name: "ssh-keepalive", Kind: DurationKind, Description: "Interval between SSH keepalives, 0s disables them", Profile: true},
+	{Name: "ssh-keepalive-max", Kind: IntKind, Description: "Unanswered SSH keepalives before disconnecting", Profile: true},
+	{Name: "ssh-config", Kind: PathKind, Description: "OpenSSH client config to read, none to skip it"},
+	{Name: "http-timeout", Kind: DurationKind, Description: "Per-request API timeout, 0 to disable"},
+	{Name: "http-proxy", Kind: URLKind, Description: "Proxy for API requests"},
+	{Name: "ca-bundle", Kind: PathKind, Description: "Extra PEM CA certificates to trust for the API"},
+	{Name: "retry.max-attempts", Kind: IntKind, Description: "API attempts per request, including the first"},
+	{Name: "retry.base-delay", Kind: DurationKind, Description: "First API retry backoff"},
+	{Name: "retry.max-delay", Kind: DurationKind, Description: "Longest API retry backoff, 0 for no cap"},
+	{Name: "tag-store", Kind: PathKind, Description: "Local instance tag store"},
+}
+
+// Find a known key, including profiles.<name>.<key>
+func Lookup(name string) (Key, bool) {
+	name = strings.ToLower(name)
+	if profileKey, ok := strings.CutPrefix(name, ProfilesKey+"."); ok {
+		_, rest, found := strings.Cut(profileKey, ".")
+		if !found {
+			return Key{}, false
+		}
+		key, ok := Lookup(rest)
+		if !ok || !key.Profile {
+			return Key{}, false
+		}
+		key.Name = name
+		return key, true
+	}
+
+	for _, key := range Keys {
+		if key.Name == name {
+			return key, true
+		}
+	}
+	return Key{}, false
+}
+
+// Check a value as decoded from YAML or the environment
+func (k Key) Check(value any) error {
+	switch k.Kind {
+	case IntKind:
+		switch v := value.(type) {
+		case int, int64, uint64:
+			return nil
+		case string:
+			if _, err := strconv.Atoi(v); err == nil {
+				return nil
+			}
+		}
+		return errors.New("must be a whole number")
+	case DurationKind:
+		// Bare numbers would be read as nanoseconds, which is never what's meant
+		if v, ok := value.(string); ok {
+			if _, err := time.ParseDuration(v); err == nil {
+				return nil
+			}
+		}
+		return errors.New("must be a duration like 30s or 2m")
+	case StringListKind:
+		switch v := value.(type) {
+		case string:
+			return nil
+		case []any:
+			for _, item := range v {
+				if _, ok := item.(string); !ok {
+					return errors.New("must be a list of strings")
+				}
+			}
+			return nil
+		case []string:
+			return nil
+		}
+		return errors.New("must be a list of strings")
+	}
+
+	v, ok := value.(string)
+	if !ok {
+		return errors.New("must be a string")
+	}
+	if k.Kind == URLKind && v != "" {
+		u, err := url.Parse(v)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return errors.New("must be an absolute URL like https://host/path")
+		}
+	}
+	return nil
+}
+
+// Parse a command-line value into what should be stored in the config file
+func (k Key) Parse(value string) (any, error) {
+	var parsed any = value
+	switch k.Kind {
+	case IntKind:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s must be a whole number", k.Name)
+		}
+		parsed = n
+	case StringListKind:
+		items := []string{}
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		parsed = items
+	}
+
+	if err := k.Check(parsed); err != nil {
+		return nil, fmt.Errorf("%s %v", k.Name, err)
+	}
+	return parsed, nil
+}
+
+// Value safe to print. Secrets keep their last 4 characters so keys can be told apart.
+func (k Key) Redact(value any) any {
+	if k.Kind != SecretKind {
+		return value
+	}
+	v := fmt.Sprint(value)
+	if len(v) <= 8 {
+		return "****"
+	}
+	return "****" + v[len(v)-4:]
+}
+
+// Redact every secret in nested settings, as from viper.AllSettings
+func Redact(settings map[string]any) map[string]any {
+	return redact("", settings)
+}
+
+func redact(prefix string, settings map[string]any) map[string]any {
+	out := make(map[string]any, len(settings))
+	for name, value := range settings {
+		path := prefix + name
+		if nested, ok := value.(map[string]any); ok {
+			out[name] = redact(path+".", nested)
+			continue
+		}
+		if key, ok := Lookup(path); ok {
+			value = key.Redact(value)
+		} else if key, ok := Lookup(Legacy[path]); ok {
+			value = key.Redact(value)
+		}
+		out[name] = value
+	}
+	return out
+}
+
+// Check nested settings against Keys. Unknown and misplaced keys are only
+// warnings, they're ignored anyway, while bad values of known keys are errors.
+func Validate(settings map[string]any) ([]Problem, error) {
+	var problems []Problem
+	validate("", settings, &problems)
+	sort.Slice(problems, func(i, j int) bool { return problems[i].Key < problems[j].Key })
+
+	var warnings, invalid []Problem
+	for _, problem := range problems {
+		if problem.Unknown {
+			warnings = append(warnings, problem)
+		} else {
+			invalid = append(invalid, problem)
+		}
+	}
+	if len(invalid) > 0 {
+		return warnings, &ValidationError{Problems: invalid}
+	}
+	return warnings, nil
+}
+
+func validate(prefix string, settings map[string]any, problems *[]Problem) {
+	for name, value := range settings {
+		path := prefix + name
+
+		if key, ok := Lookup(path); ok {
+			if err := key.Check(value); err != nil {
+				*problems = append(*problems, Problem{Key: path, Message: err.Error()})
+			}
+			continue
+		}
+
+		nested, isMap := value.(map[string]any)
+		switch {
+		case isMap && (path == ProfilesKey || isSection(path)):
+			validate(path+".", nested, problems)
+		case value == nil && (path == ProfilesKey || isSection(path)):
+			// Empty section
+		default:
+			*problems = append(*problems, Problem{Key: path, Message: unknownMessage(path), Unknown: true})
+		}
+	}
+}
+
+// Whether path is a profile or a group of keys like retry
+func isSection(path string) bool {
+	if profile, ok := strings.CutPrefix(path, ProfilesKey+"."); ok {
+		return !strings.Contains(profile, ".")
+	}
+	for _, key := range Keys {
+		if strings.HasPrefix(key.Name, path+".") {
+			return true
+		}
+	}
+	return false
+}
+
+func unknownMessage(path string) string {
+	if key, ok := Legacy[path]; ok {
+		return fmt.Sprintf("deprecated, use %s instead", key)
+	}
+	if profileKey, ok := strings.CutPrefix(path, ProfilesKey+"."); ok {
+		if _, rest, found := strings.Cut(profileKey, "."); found {
+			if _, known := Lookup(rest); known {
+				return "can't be set per profile, only at the top level"
+			}
+		}
+	}
+
+	// Catch the common camelCase and underscore spellings
+	name := path[strings.LastIndex(path, ".")+1:]
+	for _, key := range Keys {
+		if strings.ReplaceAll(key.Name[strings.LastIndex(key.Name, ".")+1:], "-", "") == strings.ReplaceAll(name, "_", "") {
+			return fmt.Sprintf("unknown key, did you mean %s?", key.Name)
+		}
+	}
+	return "unknown key"
+}
+
+func (e *ValidationError) Error() string {
+	var b strings.Builder
+	b.WriteString("invalid configuration:")
+	for _, p := range e.Problems {
+		fmt.Fprintf(&b, "\n  %s: %s", p.Key, p.Message)
+	}
+	return b.String()
+}
@@ -0,0 +1,34 @@
+package config
+
+// How a key's value is checked, parsed and shown
+type Kind int
+
+const (
+	StringKind Kind = iota
+	SecretKind
+	URLKind
+	PathKind
+	DurationKind
+	IntKind
+	StringListKind
+)
+
+// Known configuration key
+type Key struct {
+	Name        string
+	Kind        Kind
+	Description string
+	Profile     bool // Also allowed under profiles.<name>
+}
+
+// Invalid or unknown key found while validating
+type Problem struct {
+	Key     string
+	Message string
+	Unknown bool // Not a key in this place, so it's ignored
+}
+
+// Every problem found by Validate, reported together
+type ValidationError struct {
+	Problems []Problem
+}
@@ -0,0 +1,154 @@
+package filter
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Longest first, so >= isn't read as > followed by =value
+var operators = []string{"!=", ">=", "<=", "==", "!~", "=", ">", "<", "~"}
+
+// Parse a comma-separated list of conditions like
+// status=active,region=us-east-1|us-west-1,gpus>=8,name~train-*
+func Parse(expr string) (Filter, error) {
+	var f Filter
+	for _, part := range strings.Split(expr, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		condition, err := parseCondition(part)
+		if err != nil {
+			return nil, err
+		}
+		f = append(f, condition)
+	}
+	return f, nil
+}
+
+func parseCondition(part string) (Condition, error) {
+	// Find the first operator position, preferring the longest at that position
+	at, op := -1, ""
+	for _, candidate := range operators {
+		if i := strings.Index(part, candidate); i >= 0 && (at < 0 || i < at || (i == at && len(candidate) > len(op))) {
+			at, op = i, candidate
+		}
+	}
+	if at <= 0 {
+		return Condition{}, fmt.Errorf("invalid filter %q, expected key<op>value with one of %s", part, strings.Join(operators, " "))
+	}
+
+	key := strings.TrimSpace(part[:at])
+	value := strings.TrimSpace(part[at+len(op):])
+	if op == "==" {
+		op = "="
+	}
+
+	condition := Condition{Key: key, Op: op, Values: strings.Split(value, "|")}
+	for _, pattern := range condition.Values {
+		if op == "~" || op == "!~" {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return Condition{}, fmt.Errorf("invalid pattern %q in filter %q: %v", pattern, part, err)
+			}
+		}
+	}
+	if op == ">" || op == "<" || op == ">=" || op == "<=" {
+		if len(condition.Values) != 1 {
+			return Condition{}, fmt.Errorf("filter %q compares against more than one value", part)
+		}
+	}
+
+	return condition, nil
+}
+
+// Error out on keys that known rejects, so typos don't silently match nothing
+func (f Filter) Check(known func(key string) bool) error {
+	for _, condition := range f {
+		if !known(condition.Key) {
+			return fmt.Errorf("unknown filter key %q", condition.Key)
+		}
+	}
+	return nil
+}
+
+func (f Filter) Match(item Fielder) bool {
+	for _, condition := range f {
+		if !condition.Match(item) {
+			return false
+		}
+	}
+	return true
+}
+
+// Missing fields compare as empty strings
+func (c Condition) Match(item Fielder) bool {
+	actual, _ := item.Field(c.Key)
+
+	switch c.Op {
+	case "=":
+		return c.any(func(value string) bool { return compare(actual, value) == 0 })
+	case "!=":
+		return !c.any(func(value string) bool { return compare(actual, value) == 0 })
+	case "~":
+		return c.any(func(pattern string) bool { return glob(pattern, actual) })
+	case "!~":
+		return !c.any(func(pattern string) bool { return glob(pattern, actual) })
+	case ">":
+		return compare(actual, c.Values[0]) > 0
+	case "<":
+		return compare(actual, c.Values[0]) < 0
+	case ">=":
+		return compare(actual, c.Values[0]) >= 0
+	case "<=":
+		return compare(actual, c.Values[0]) <= 0
+	}
+	return false
+}
+
+func (c Condition) any(test func(string) bool) bool {
+	for _, value := range c.Values {
+		if test(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// Numbers compare numerically, anything else case-insensitively as strings
+func compare(a, b string) int {
+	x, errA := strconv.ParseFloat(a, 64)
+	y, errB := strconv.ParseFloat(b, 64)
+	if errA == nil && errB == nil {
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+		return 0
+	}
+	return strings.Compare(strings.ToLower(a), strings.ToLower(b))
+}
+
+func glob(pattern, value string) bool {
+	ok, _ := path.Match(strings.ToLower(pattern), strings.ToLower(value))
+	return ok
+}
+
+// Keep only the items that match
+func Apply[T Fielder](f Filter, items []T) []T {
+	if len(f) == 0 {
+		return items
+	}
+
+	matched := []T{}
+	for _, item := range items {
+		if f.Match(item) {
+			matched = append(matched, item)
+		}
+	}
+	return matched
+}
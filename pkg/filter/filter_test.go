@@ -0,0 +1,155 @@
+package filter
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type fields map[string]string
+
+func (f fields) Field(name string) (string, bool) {
+	value, ok := f[name]
+	return value, ok
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		expr string
+		want Filter
+	}{
+		{"empty", "", nil},
+		{"only separators", " , ,", nil},
+		{"equals", "status=active", Filter{{Key: "status", Op: "=", Values: []string{"active"}}}},
+		{"double equals", "status==active", Filter{{Key: "status", Op: "=", Values: []string{"active"}}}},
+		{"not equals", "status!=active", Filter{{Key: "status", Op: "!=", Values: []string{"active"}}}},
+		{"alternatives", "region=us-east-1|us-west-1", Filter{{Key: "region", Op: "=", Values: []string{"us-east-1", "us-west-1"}}}},
+		{"greater or equal", "gpus>=8", Filter{{Key: "gpus", Op: ">=", Values: []string{"8"}}}},
+		{"less or equal", "gpus<=8", Filter{{Key: "gpus", Op: "<=", Values: []string{"8"}}}},
+		{"greater", "gpus>1", Filter{{Key: "gpus", Op: ">", Values: []string{"1"}}}},
+		{"less", "gpus<1", Filter{{Key: "gpus", Op: "<", Values: []string{"1"}}}},
+		{"glob", "name~train-*", Filter{{Key: "name", Op: "~", Values: []string{"train-*"}}}},
+		{"negated glob", "name!~train-*", Filter{{Key: "name", Op: "!~", Values: []string{"train-*"}}}},
+		{"first operator wins", "tag=a>b", Filter{{Key: "tag", Op: "=", Values: []string{"a>b"}}}},
+		{"empty value", "name=", Filter{{Key: "name", Op: "=", Values: []string{""}}}},
+		{"spaces trimmed", " status = active , gpus >= 8 ", Filter{
+			{Key: "status", Op: "=", Values: []string{"active"}},
+			{Key: "gpus", Op: ">=", Values: []string{"8"}},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.expr)
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", tt.expr, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse(%q) = %+v, want %+v", tt.expr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		expr string
+		want string
+	}{
+		{"no operator", "active", "expected key<op>value"},
+		{"no key", "=active", "expected key<op>value"},
+		{"bad pattern", "name~[", "invalid pattern"},
+		{"comparison with alternatives", "gpus>=1|2", "more than one value"},
+		{"one bad condition of many", "status=active,oops", `invalid filter "oops"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(tt.expr)
+			if err == nil {
+				t.Fatalf("Parse(%q) succeeded, want error containing %q", tt.expr, tt.want)
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Parse(%q) error = %q, want it to contain %q", tt.expr, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatch(t *testing.T) {
+	item := fields{"status": "active", "name": "Train-12", "gpus": "8", "price": "10.5", "region": "us-east-1"}
+
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{"", true},
+		{"status=active", true},
+		{"status=ACTIVE", true},
+		{"status=booting", false},
+		{"status=booting|active", true},
+		{"status!=booting|active", false},
+		{"status!=booting", true},
+		{"name~train-*", true},
+		{"name~infer-*|train-1?", true},
+		{"name!~train-*", false},
+		{"gpus>=8", true},
+		{"gpus>8", false},
+		{"gpus>=10", false},
+		{"gpus<10", true},
+		{"gpus=8.0", true},
+		{"price<=10.5", true},
+		{"region>us-a", true},
+		{"missing=", true},
+		{"missing=x", false},
+		{"status=active,gpus>=8", true},
+		{"status=active,gpus>8", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			f, err := Parse(tt.expr)
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", tt.expr, err)
+			}
+			if got := f.Match(item); got != tt.want {
+				t.Errorf("%q matched %v, want %v", tt.expr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheck(t *testing.T) {
+	known := func(key string) bool { return key == "status" || key == "name" }
+
+	f, _ := Parse("status=active,name~a*")
+	if err := f.Check(known); err != nil {
+		t.Errorf("Check on known keys: %v", err)
+	}
+
+	f, _ = Parse("status=active,stauts=active")
+	if err := f.Check(known); err == nil || !strings.Contains(err.Error(), `"stauts"`) {
+		t.Errorf("Check on a typo = %v, want unknown filter key error", err)
+	}
+}
+
+func TestApply(t *testing.T) {
+	items := []fields{{"name": "a", "gpus": "1"}, {"name": "b", "gpus": "8"}, {"name": "c", "gpus": "8"}}
+
+	if got := Apply(nil, items); len(got) != 3 {
+		t.Errorf("empty filter kept %d items, want 3", len(got))
+	}
+
+	f, _ := Parse("gpus>=8")
+	got := Apply(f, items)
+	if len(got) != 2 || got[0]["name"] != "b" || got[1]["name"] != "c" {
+		t.Errorf("Apply(gpus>=8) = %v, want b and c in order", got)
+	}
+
+	f, _ = Parse("gpus>8")
+	if got := Apply(f, items); got == nil || len(got) != 0 {
+		t.Errorf("Apply with no matches = %#v, want an empty slice", got)
+	}
+}
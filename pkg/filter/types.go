@@ -0,0 +1,16 @@
+package filter
+
+// Anything that can be filtered, by named string fields
+type Fielder interface {
+	Field(name string) (string, bool)
+}
+
+// A single key-op-value test, Values are alternatives separated by |
+type Condition struct {
+	Key    string
+	Op     string
+	Values []string
+}
+
+// All conditions must hold, an empty filter matches everything
+type Filter []Condition
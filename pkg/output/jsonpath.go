@@ -0,0 +1,289 @@
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A small JSONPath dialect in the style of kubectl: text with {path} blocks,
+// {range path}...{end} loops and {"literal"} strings. Paths support .field,
+// ['field'], [n], [*] and .* against the JSON form of the value.
+
+type jsonPathNode struct {
+	text     string // Literal text, for text nodes
+	isText   bool
+	path     []pathSegment  // Expression to print, or to range over
+	rooted   bool           // Path starts at $ rather than the current value
+	isRange  bool           // Loop over path, rendering children for each value
+	children []jsonPathNode // Body of a range
+}
+
+type pathSegment struct {
+	field    string
+	index    int
+	isIndex  bool
+	wildcard bool
+}
+
+func writeJSONPath(w io.Writer, expr string, v any) error {
+	nodes, err := parseJSONPath(expr)
+	if err != nil {
+		return fmt.Errorf("error parsing jsonpath: %v", err)
+	}
+
+	data, err := toJSONValue(v)
+	if err != nil {
+		return err
+	}
+
+	var b strings.Builder
+	if err := renderJSONPath(&b, nodes, data, data); err != nil {
+		return fmt.Errorf("error executing jsonpath: %v", err)
+	}
+
+	out := b.String()
+	if !strings.HasSuffix(out, "\n") {
+		out += "\n"
+	}
+	_, err = io.WriteString(w, out)
+	return err
+}
+
+func parseJSONPath(expr string) ([]jsonPathNode, error) {
+	// Stack of open ranges, the bottom is the top level
+	stack := [][]jsonPathNode{{}}
+	var ranges []jsonPathNode
+
+	for len(expr) > 0 {
+		start := strings.IndexByte(expr, '{')
+		if start < 0 {
+			stack[len(stack)-1] = append(stack[len(stack)-1], jsonPathNode{text: expr, isText: true})
+			break
+		}
+		if start > 0 {
+			stack[len(stack)-1] = append(stack[len(stack)-1], jsonPathNode{text: expr[:start], isText: true})
+		}
+
+		end := closingDelim(expr[start:], '}')
+		if end < 0 {
+			return nil, fmt.Errorf("unclosed { in %q", expr)
+		}
+		block := strings.TrimSpace(expr[start+1 : start+end])
+		expr = expr[start+end+1:]
+
+		switch {
+		case block == "end":
+			if len(ranges) == 0 {
+				return nil, fmt.Errorf("{end} without {range}")
+			}
+			node := ranges[len(ranges)-1]
+			node.children = stack[len(stack)-1]
+			ranges = ranges[:len(ranges)-1]
+			stack = stack[:len(stack)-1]
+			stack[len(stack)-1] = append(stack[len(stack)-1], node)
+		case strings.HasPrefix(block, "range "):
+			path, rooted, err := parsePath(strings.TrimSpace(strings.TrimPrefix(block, "range ")))
+			if err != nil {
+				return nil, err
+			}
+			ranges = append(ranges, jsonPathNode{path: path, rooted: rooted, isRange: true})
+			stack = append(stack, []jsonPathNode{})
+		case strings.HasPrefix(block, `"`):
+			text, err := strconv.Unquote(block)
+			if err != nil {
+				return nil, fmt.Errorf("invalid string literal %s", block)
+			}
+			stack[len(stack)-1] = append(stack[len(stack)-1], jsonPathNode{text: text, isText: true})
+		case strings.HasPrefix(block, "'") && strings.HasSuffix(block, "'") && len(block) > 1:
+			stack[len(stack)-1] = append(stack[len(stack)-1], jsonPathNode{text: block[1 : len(block)-1], isText: true})
+		default:
+			path, rooted, err := parsePath(block)
+			if err != nil {
+				return nil, err
+			}
+			stack[len(stack)-1] = append(stack[len(stack)-1], jsonPathNode{path: path, rooted: rooted})
+		}
+	}
+
+	if len(ranges) > 0 {
+		return nil, fmt.Errorf("{range} without {end}")
+	}
+	return stack[0], nil
+}
+
+// Index of the close byte ending the block s starts with, skipping any inside
+// quotes like {.labels["a}b"]}, or -1
+func closingDelim(s string, close byte) int {
+	var quote byte
+	for i := 1; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0 && c == '\\':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == close:
+			return i
+		}
+	}
+	return -1
+}
+
+func parsePath(path string) ([]pathSegment, bool, error) {
+	rooted := false
+	switch {
+	case strings.HasPrefix(path, "$"):
+		rooted = true
+		path = path[1:]
+	case strings.HasPrefix(path, "@"):
+		path = path[1:]
+	}
+
+	var segments []pathSegment
+	for len(path) > 0 {
+		switch path[0] {
+		case '.':
+			path = path[1:]
+			if path == "" || path[0] == '[' {
+				continue
+			}
+			if path[0] == '.' {
+				return nil, false, fmt.Errorf("recursive descent (..) is not supported")
+			}
+			end := strings.IndexAny(path, ".[")
+			if end < 0 {
+				end = len(path)
+			}
+			name := path[:end]
+			path = path[end:]
+			if name == "*" {
+				segments = append(segments, pathSegment{wildcard: true})
+			} else {
+				segments = append(segments, pathSegment{field: name})
+			}
+		case '[':
+			end := closingDelim(path, ']')
+			if end < 0 {
+				return nil, false, fmt.Errorf("unclosed [ in path")
+			}
+			inner := strings.TrimSpace(path[1:end])
+			path = path[end+1:]
+			switch {
+			case inner == "*":
+				segments = append(segments, pathSegment{wildcard: true})
+			case len(inner) > 1 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0]:
+				segments = append(segments, pathSegment{field: inner[1 : len(inner)-1]})
+			default:
+				index, err := strconv.Atoi(inner)
+				if err != nil {
+					return nil, false, fmt.Errorf("unsupported subscript [%s]", inner)
+				}
+				segments = append(segments, pathSegment{index: index, isIndex: true})
+			}
+		default:
+			return nil, false, fmt.Errorf("unexpected %q in path, fields start with .", path[0])
+		}
+	}
+
+	return segments, rooted, nil
+}
+
+func renderJSONPath(b *strings.Builder, nodes []jsonPathNode, root, current any) error {
+	for _, node := range nodes {
+		if node.isText {
+			b.WriteString(node.text)
+			continue
+		}
+
+		start := current
+		if node.rooted {
+			start = root
+		}
+		values := evalPath(node.path, start)
+
+		if node.isRange {
+			for _, value := range values {
+				if err := renderJSONPath(b, node.children, root, value); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		printed := make([]string, len(values))
+		for i, value := range values {
+			printed[i] = formatJSONValue(value)
+		}
+		b.WriteString(strings.Join(printed, " "))
+	}
+
+	return nil
+}
+
+func evalPath(path []pathSegment, start any) []any {
+	values := []any{start}
+	for _, segment := range path {
+		var next []any
+		for _, value := range values {
+			switch v := value.(type) {
+			case map[string]any:
+				switch {
+				case segment.wildcard:
+					keys := make([]string, 0, len(v))
+					for key := range v {
+						keys = append(keys, key)
+					}
+					sort.Strings(keys)
+					for _, key := range keys {
+						next = append(next, v[key])
+					}
+				case !segment.isIndex:
+					if field, ok := v[segment.field]; ok {
+						next = append(next, field)
+					}
+				}
+			case []any:
+				switch {
+				case segment.wildcard:
+					next = append(next, v...)
+				case segment.isIndex:
+					index := segment.index
+					if index < 0 {
+						index += len(v)
+					}
+					if index >= 0 && index < len(v) {
+						next = append(next, v[index])
+					}
+				}
+			}
+		}
+		values = next
+	}
+	return values
+}
+
+func formatJSONValue(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(raw)
+}
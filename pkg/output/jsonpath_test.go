@@ -0,0 +1,91 @@
+package output
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWriteJSONPath(t *testing.T) {
+	data := map[string]any{
+		"name":   "train-1",
+		"region": map[string]any{"name": "us-east-1"},
+		"items":  []any{1, 2, 3},
+		"labels": map[string]any{"b": "y", "a": "x", "a.b": "dot", "a}b": "brace", "a]b": "bracket"},
+		"ok":     true,
+	}
+
+	tests := []struct {
+		name string
+		expr string
+		want string
+	}{
+		{"field", "{.name}", "train-1\n"},
+		{"nested field", "{.region.name}", "us-east-1\n"},
+		{"text around blocks", "name={.name} ok={.ok}", "name=train-1 ok=true\n"},
+		{"no blocks", "plain", "plain\n"},
+		{"trailing newline kept", "{.name}{\"\\n\"}", "train-1\n"},
+		{"rooted", "{$.name}", "train-1\n"},
+		{"current", "{@.name}", "train-1\n"},
+		{"index", "{.items[0]}", "1\n"},
+		{"negative index", "{.items[-1]}", "3\n"},
+		{"index out of range", "{.items[5]}", "\n"},
+		{"array wildcard", "{.items[*]}", "1 2 3\n"},
+		{"map wildcard sorted by key", "{.labels.*}", "x dot bracket brace y\n"},
+		{"bracket wildcard", "{.items.*}", "1 2 3\n"},
+		{"single quoted key", "{.labels['a.b']}", "dot\n"},
+		{"double quoted key", `{.labels["a"]}`, "x\n"},
+		{"brace inside quoted key", `{.labels["a}b"]}`, "brace\n"},
+		{"bracket inside quoted key", `{.labels['a]b']}`, "bracket\n"},
+		{"missing field", "{.nope}", "\n"},
+		{"object as json", "{.region}", `{"name":"us-east-1"}` + "\n"},
+		{"double quoted literal", `{"a\tb"}`, "a\tb\n"},
+		{"brace in literal", `{"}"}`, "}\n"},
+		{"single quoted literal", "{'x'}", "x\n"},
+		{"range", `{range .items[*]}[{@}]{end}`, "[1][2][3]\n"},
+		{"range with root", `{range .items[*]}{$.name}:{@} {end}`, "train-1:1 train-1:2 train-1:3 \n"},
+		{"nested range", `{range .items[*]}{range $.items[0]}{@}{end}{end}`, "111\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b strings.Builder
+			if err := writeJSONPath(&b, tt.expr, data); err != nil {
+				t.Fatalf("writeJSONPath(%q): %v", tt.expr, err)
+			}
+			if got := b.String(); got != tt.want {
+				t.Errorf("writeJSONPath(%q) = %q, want %q", tt.expr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseJSONPathErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		expr string
+		want string
+	}{
+		{"unclosed block", "{.name", "unclosed {"},
+		{"unclosed quote", `{"}`, "unclosed {"},
+		{"end without range", "{end}", "{end} without {range}"},
+		{"range without end", "{range .items[*]}{@}", "{range} without {end}"},
+		{"recursive descent", "{..name}", "recursive descent"},
+		{"bad subscript", "{.items[x]}", "unsupported subscript"},
+		{"unclosed subscript", "{.items[0}", "unclosed ["},
+		{"missing dot", "{name}", "fields start with ."},
+		{"bad literal", `{"\q"}`, "invalid string literal"},
+		{"bad range path", "{range name}{end}", "fields start with ."},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseJSONPath(tt.expr)
+			if err == nil {
+				t.Fatalf("parseJSONPath(%q) succeeded, want error containing %q", tt.expr, tt.want)
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("parseJSONPath(%q) error = %q, want it to contain %q", tt.expr, err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,151 @@
+package output
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Parse a --output value, using fallback when it's empty
+func ParseFormat(value, fallback string) (Format, error) {
+	if value == "" {
+		value = fallback
+	}
+
+	kind, expr, hasExpr := strings.Cut(value, "=")
+	switch kind {
+	case YAMLKind, JSONKind, TableKind, WideKind, NameKind:
+		if hasExpr {
+			return Format{}, fmt.Errorf("output format %q takes no expression", kind)
+		}
+		return Format{Kind: kind}, nil
+	case TemplateKind, "template":
+		if expr == "" {
+			return Format{}, fmt.Errorf("output format %q needs a template, e.g. %s='{{range .}}{{.id}}{{\"\\n\"}}{{end}}'", kind, kind)
+		}
+		return Format{Kind: TemplateKind, Expr: expr}, nil
+	case JSONPathKind:
+		if expr == "" {
+			return Format{}, fmt.Errorf("output format %q needs an expression, e.g. jsonpath='{[*].id}'", kind)
+		}
+		return Format{Kind: JSONPathKind, Expr: expr}, nil
+	}
+
+	return Format{}, fmt.Errorf("unknown output format %q, expected one of yaml, json, table, wide, name, go-template=..., jsonpath=...", value)
+}
+
+// Print a list of items in the given format, using table for table, wide and name
+func PrintList[T any](w io.Writer, format Format, items []T, table Table[T]) error {
+	switch format.Kind {
+	case TableKind, WideKind:
+		return writeTable(w, items, table.Columns, format.Kind == WideKind)
+	case NameKind:
+		if table.Name == nil {
+			return fmt.Errorf("output format %q is not supported here", format.Kind)
+		}
+		for _, item := range items {
+			fmt.Fprintln(w, table.Name(item))
+		}
+		return nil
+	}
+
+	// Always emit a list, never null, so jq and templates can range over it
+	if items == nil {
+		items = []T{}
+	}
+	return Print(w, format, items, nil)
+}
+
+// Print a single value in the given format. tabular renders table and wide
+// output, formats without a renderer are rejected.
+func Print(w io.Writer, format Format, v any, tabular func(w io.Writer, wide bool) error) error {
+	switch format.Kind {
+	case YAMLKind:
+		out, err := yaml.Marshal(v)
+		if err != nil {
+			return fmt.Errorf("error marshalling YAML: %v", err)
+		}
+		_, err = w.Write(out)
+		return err
+	case JSONKind:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(v)
+	case TemplateKind:
+		return writeTemplate(w, format.Expr, v)
+	case JSONPathKind:
+		return writeJSONPath(w, format.Expr, v)
+	case TableKind, WideKind:
+		if tabular != nil {
+			return tabular(w, format.Kind == WideKind)
+		}
+	}
+
+	return fmt.Errorf("output format %q is not supported here", format.Kind)
+}
+
+func writeTable[T any](w io.Writer, items []T, columns []Column[T], wide bool) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	var shown []Column[T]
+	for _, column := range columns {
+		if wide || !column.Wide {
+			shown = append(shown, column)
+		}
+	}
+
+	cells := make([]string, len(shown))
+	for i, column := range shown {
+		cells[i] = column.Header
+	}
+	fmt.Fprintln(tw, strings.Join(cells, "\t"))
+
+	for _, item := range items {
+		for i, column := range shown {
+			cells[i] = column.Value(item)
+		}
+		fmt.Fprintln(tw, strings.Join(cells, "\t"))
+	}
+
+	return tw.Flush()
+}
+
+// Templates see the JSON form of v, so field names match -o json
+func writeTemplate(w io.Writer, text string, v any) error {
+	tmpl, err := template.New("output").Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return fmt.Errorf("error parsing template: %v", err)
+	}
+
+	data, err := toJSONValue(v)
+	if err != nil {
+		return err
+	}
+
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, data); err != nil {
+		return fmt.Errorf("error executing template: %v", err)
+	}
+	_, err = b.WriteTo(w)
+	return err
+}
+
+// Round-trip through JSON to get plain maps and slices keyed by JSON names
+func toJSONValue(v any) (any, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("error marshalling JSON: %v", err)
+	}
+
+	var data any
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return nil, fmt.Errorf("error unmarshalling JSON: %v", err)
+	}
+	return data, nil
+}
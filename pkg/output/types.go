@@ -0,0 +1,30 @@
+package output
+
+// Output format kinds accepted by ParseFormat
+const (
+	YAMLKind     = "yaml"
+	JSONKind     = "json"
+	TableKind    = "table"
+	WideKind     = "wide"
+	NameKind     = "name"
+	TemplateKind = "go-template"
+	JSONPathKind = "jsonpath"
+)
+
+type Format struct {
+	Kind string
+	Expr string // Template or JSONPath expression, for those kinds
+}
+
+// One table column, Wide columns only show in wide output
+type Column[T any] struct {
+	Header string
+	Wide   bool
+	Value  func(T) string
+}
+
+// How to render a list of T as a table or as names
+type Table[T any] struct {
+	Columns []Column[T]
+	Name    func(T) string
+}
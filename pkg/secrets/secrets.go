@@ -0,0 +1,292 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+// Service name entries are stored under in every keyring
+const service = "lambdactl"
+
+var ErrNotFound = errors.New("secret not found in keyring")
+
+// Source from the api-key* config keys
+func SourceFromConfig() Source {
+	return Source{
+		Key:     viper.GetString("api-key"),
+		Command: viper.GetString("api-key-command"),
+		File:    viper.GetString("api-key-file"),
+		Keyring: viper.GetString("api-key-keyring"),
+	}
+}
+
+func (s Source) IsEmpty() bool {
+	return s.Key == "" && s.Command == "" && s.File == "" && s.Keyring == ""
+}
+
+// Produce the key from the first configured source. Commands and keyrings
+// can prompt, so this only runs once a client is actually needed.
+func (s Source) Resolve(ctx context.Context) (string, error) {
+	switch {
+	case s.Key != "":
+		return s.Key, nil
+	case s.Command != "":
+		return runCommand(ctx, s.Command)
+	case s.File != "":
+		return readFile(s.File)
+	case s.Keyring != "":
+		keyring, err := OpenKeyring(viper.GetString("keyring-backend"))
+		if err != nil {
+			return "", err
+		}
+		key, err := keyring.Get(s.Keyring)
+		if err != nil {
+			return "", fmt.Errorf("failed to read API key %q from keyring: %w", s.Keyring, err)
+		}
+		return key, nil
+	}
+	return "", errors.New("no API key configured, set api-key, api-key-command, api-key-file or api-key-keyring")
+}
+
+func runCommand(ctx context.Context, command string) (string, error) {
+	shell, flag := "sh", "-c"
+	if runtime.GOOS == "windows" {
+		shell, flag = "cmd", "/C"
+	}
+
+	var stdout bytes.Buffer
+	c := exec.CommandContext(ctx, shell, flag, command)
+	c.Stdout = &stdout
+	// Let pinentry and friends talk to the user
+	c.Stdin = os.Stdin
+	c.Stderr = os.Stderr
+
+	if err := c.Run(); err != nil {
+		return "", fmt.Errorf("api-key-command failed: %v", err)
+	}
+
+	key := strings.TrimSpace(stdout.String())
+	if key == "" {
+		return "", errors.New("api-key-command printed nothing")
+	}
+	return key, nil
+}
+
+func readFile(path string) (string, error) {
+	path, err := expandPath(path)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read api-key-file: %v", err)
+	}
+
+	key := strings.TrimSpace(string(data))
+	if key == "" {
+		return "", fmt.Errorf("api-key-file %s is empty", path)
+	}
+	return key, nil
+}
+
+// Expand env vars and a leading ~/
+func expandPath(path string) (string, error) {
+	path = os.ExpandEnv(path)
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		path = filepath.Join(home, rest)
+	}
+	return path, nil
+}
+
+// Keyring for backend: auto, secret-service, macos or file. Auto uses the
+// OS keyring when its tool is available and falls back to the file.
+func OpenKeyring(backend string) (Keyring, error) {
+	switch backend {
+	case "", "auto":
+		if runtime.GOOS == "darwin" && hasCommand("security") {
+			return macOSKeyring{}, nil
+		}
+		if runtime.GOOS == "linux" && hasCommand("secret-tool") && os.Getenv("DBUS_SESSION_BUS_ADDRESS") != "" {
+			return secretServiceKeyring{}, nil
+		}
+		return newFileKeyring()
+	case "secret-service":
+		return secretServiceKeyring{}, nil
+	case "macos":
+		return macOSKeyring{}, nil
+	case "file":
+		return newFileKeyring()
+	}
+	return nil, fmt.Errorf("unknown keyring-backend %q, use auto, secret-service, macos or file", backend)
+}
+
+func hasCommand(name string) bool {
+	_, err := exec.LookPath(name)
+	return err == nil
+}
+
+func (secretServiceKeyring) Get(account string) (string, error) {
+	out, err := exec.Command("secret-tool", "lookup", "service", service, "account", account).Output()
+	// Missing entries exit 1 with no output
+	if len(bytes.TrimSpace(out)) == 0 {
+		if err != nil {
+			var exitErr *exec.ExitError
+			if !errors.As(err, &exitErr) || exitErr.ExitCode() != 1 {
+				return "", fmt.Errorf("secret-tool lookup failed: %v", err)
+			}
+		}
+		return "", ErrNotFound
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func (secretServiceKeyring) Set(account, secret string) error {
+	c := exec.Command("secret-tool", "store", "--label", service+" "+account, "service", service, "account", account)
+	c.Stdin = strings.NewReader(secret)
+	if out, err := c.CombinedOutput(); err != nil {
+		return fmt.Errorf("secret-tool store failed: %v: %s", err, bytes.TrimSpace(out))
+	}
+	return nil
+}
+
+func (macOSKeyring) Get(account string) (string, error) {
+	out, err := exec.Command("security", "find-generic-password", "-s", service, "-a", account, "-w").Output()
+	if err != nil {
+		// 44 is errSecItemNotFound
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == 44 {
+			return "", ErrNotFound
+		}
+		return "", fmt.Errorf("security find-generic-password failed: %v", err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func (macOSKeyring) Set(account, secret string) error {
+	if strings.ContainsAny(secret, "\r\n") {
+		return errors.New("secret can't contain line breaks")
+	}
+
+	// add-generic-password only takes the password as an argument, where ps
+	// would show it, so feed the command to security's interactive mode on
+	// stdin instead. -U updates in place.
+	command := fmt.Sprintf("add-generic-password -U -s %s -a %s -w %s\n", securityQuote(service), securityQuote(account), securityQuote(secret))
+	c := exec.Command("security", "-i")
+	c.Stdin = strings.NewReader(command)
+
+	// Interactive mode exits zero on failed commands, but besides its prompt
+	// only says anything when they fail
+	out, err := c.CombinedOutput()
+	out = bytes.ReplaceAll(out, []byte("security> "), nil)
+	if err != nil || len(bytes.TrimSpace(out)) > 0 {
+		return fmt.Errorf("security add-generic-password failed: %v: %s", err, bytes.TrimSpace(out))
+	}
+	return nil
+}
+
+// Double-quote s for security's interactive mode
+func securityQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// File at the keyring-file config key, default ~/.lambda-keyring.yaml
+func newFileKeyring() (*fileKeyring, error) {
+	if path := viper.GetString("keyring-file"); path != "" {
+		path, err := expandPath(path)
+		if err != nil {
+			return nil, err
+		}
+		return &fileKeyring{path: path}, nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, err
+	}
+	return &fileKeyring{path: filepath.Join(home, ".lambda-keyring.yaml")}, nil
+}
+
+func (k *fileKeyring) load() (map[string]string, error) {
+	entries := map[string]string{}
+
+	info, err := os.Stat(k.path)
+	if os.IsNotExist(err) {
+		return entries, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read keyring file: %v", err)
+	}
+	// Same rule ssh applies to private keys
+	if runtime.GOOS != "windows" && info.Mode().Perm()&0o077 != 0 {
+		return nil, fmt.Errorf("keyring file %s is accessible by other users, run chmod 600 on it", k.path)
+	}
+
+	data, err := os.ReadFile(k.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read keyring file: %v", err)
+	}
+	if err := yaml.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("failed to parse keyring file: %v", err)
+	}
+	return entries, nil
+}
+
+func (k *fileKeyring) Get(account string) (string, error) {
+	entries, err := k.load()
+	if err != nil {
+		return "", err
+	}
+	secret, ok := entries[account]
+	if !ok {
+		return "", ErrNotFound
+	}
+	return secret, nil
+}
+
+// Rewrite the file atomically, CreateTemp already makes it 0600
+func (k *fileKeyring) Set(account, secret string) error {
+	entries, err := k.load()
+	if err != nil {
+		return err
+	}
+	entries[account] = secret
+
+	data, err := yaml.Marshal(entries)
+	if err != nil {
+		return fmt.Errorf("failed to marshal keyring file: %v", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(k.path), ".lambda-keyring-*")
+	if err != nil {
+		return fmt.Errorf("failed to write keyring file: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write keyring file: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write keyring file: %v", err)
+	}
+
+	if err := os.Rename(tmp.Name(), k.path); err != nil {
+		return fmt.Errorf("failed to write keyring file: %v", err)
+	}
+	return nil
+}
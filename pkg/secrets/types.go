@@ -0,0 +1,26 @@
+package secrets
+
+// Where the API key comes from, in order of precedence
+type Source struct {
+	Key     string // Plaintext, from config or LAMBDA_API_KEY
+	Command string // Shell command printing the key, e.g. pass show lambda
+	File    string // File holding just the key
+	Keyring string // Account name in the OS keyring
+}
+
+// Secret store keyed by account name
+type Keyring interface {
+	Get(account string) (string, error)
+	Set(account, secret string) error
+}
+
+// freedesktop Secret Service through secret-tool, e.g. GNOME Keyring or KWallet
+type secretServiceKeyring struct{}
+
+// macOS login keychain through security
+type macOSKeyring struct{}
+
+// 0600 YAML file, for machines without a keyring daemon
+type fileKeyring struct {
+	path string
+}
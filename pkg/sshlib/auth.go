@@ -0,0 +1,264 @@
+package sshlib
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/spf13/viper"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/term"
+)
+
+// Auth methods, tried in the order given by ssh-auth
+const (
+	AuthAgent = "agent" // Keys and certificates held by $SSH_AUTH_SOCK
+	AuthKeys  = "keys"  // Key files, with their -cert.pub certificates
+)
+
+var DefaultAuth = []string{AuthAgent, AuthKeys}
+
+// Decrypted signers by key path, so parallel connections prompt only once
+var (
+	keySignersMu sync.Mutex
+	keySigners   = map[string][]ssh.Signer{}
+)
+
+// Build the auth chain for target. The agent connection, if any, must stay
+// open until the handshake is done, so the caller closes it.
+func authMethods(target SSHTarget) ([]ssh.AuthMethod, func(), *authFailures, error) {
+	failures := &authFailures{}
+	closers := []func(){}
+	closeAll := func() {
+		for _, c := range closers {
+			c()
+		}
+	}
+
+	// Signer sources in ssh-auth order
+	var sources []func() []ssh.Signer
+	for _, method := range target.Auth {
+		switch method {
+		case AuthAgent:
+			socket := os.Getenv("SSH_AUTH_SOCK")
+			if socket == "" {
+				failures.add("agent: SSH_AUTH_SOCK is not set")
+				continue
+			}
+			conn, err := net.Dial("unix", socket)
+			if err != nil {
+				failures.add("agent: %v", err)
+				continue
+			}
+			closers = append(closers, func() { conn.Close() })
+			agentClient := agent.NewClient(conn)
+			sources = append(sources, func() []ssh.Signer {
+				signers, err := agentClient.Signers()
+				if err != nil {
+					failures.add("agent: %v", err)
+				}
+				return signers
+			})
+		case AuthKeys:
+			sources = append(sources, func() []ssh.Signer {
+				return keyFileSigners(target, failures)
+			})
+		default:
+			closeAll()
+			return nil, nil, nil, fmt.Errorf("unknown ssh-auth method %q, use %s or %s", method, AuthAgent, AuthKeys)
+		}
+	}
+
+	// A single publickey method, the client never retries a method by name
+	// once it fails, so a second one would never get its turn
+	methods := []ssh.AuthMethod{ssh.PublicKeysCallback(func() ([]ssh.Signer, error) {
+		var signers []ssh.Signer
+		for _, source := range sources {
+			signers = append(signers, source()...)
+		}
+		return signers, nil
+	})}
+
+	return methods, closeAll, failures, nil
+}
+
+// Signers for every usable key file, certificates first. Problems are noted
+// rather than returned, an error here would abort the rest of the chain.
+func keyFileSigners(target SSHTarget, failures *authFailures) []ssh.Signer {
+	var signers []ssh.Signer
+	for _, name := range append([]string{target.KeyName}, target.KeyFiles...) {
+		if name == "" {
+			continue
+		}
+
+		keyFile, err := KeyPath(name)
+		if err != nil {
+			failures.add("%s: %v", name, err)
+			continue
+		}
+
+		keySigners, err := loadKeyFile(keyFile)
+		if err != nil {
+			failures.add("%s: %v", keyFile, err)
+			continue
+		}
+		signers = append(signers, keySigners...)
+	}
+	return signers
+}
+
+// Key path with env vars expanded, relative ones are under ~/.ssh
+func KeyPath(name string) (string, error) {
+	keyFile, err := expandHome(os.ExpandEnv(name))
+	if err != nil {
+		return "", err
+	}
+	if !filepath.IsAbs(keyFile) {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		keyFile = filepath.Join(home, ".ssh", keyFile)
+	}
+	return keyFile, nil
+}
+
+func loadKeyFile(keyFile string) ([]ssh.Signer, error) {
+	keySignersMu.Lock()
+	defer keySignersMu.Unlock()
+
+	if signers, ok := keySigners[keyFile]; ok {
+		return signers, nil
+	}
+
+	key, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open private key: %v", err)
+	}
+
+	signer, err := ssh.ParsePrivateKey(key)
+	var missing *ssh.PassphraseMissingError
+	if errors.As(err, &missing) {
+		if missing.PublicKey != nil {
+			// Offered by its public half, the passphrase is only asked for
+			// once the server accepts it, so the agent's keys go first
+			signer, err = &lazySigner{public: missing.PublicKey, keyFile: keyFile, key: key}, nil
+		} else {
+			signer, err = parseEncryptedKey(keyFile, key)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %v", err)
+	}
+
+	// OpenSSH's convention, key-cert.pub next to key
+	signers := []ssh.Signer{signer}
+	if data, err := os.ReadFile(keyFile + "-cert.pub"); err == nil {
+		certSigner, err := certSigner(signer, data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load certificate %s-cert.pub: %v", keyFile, err)
+		}
+		signers = []ssh.Signer{certSigner, signer}
+	}
+
+	keySigners[keyFile] = signers
+	return signers, nil
+}
+
+func certSigner(signer ssh.Signer, data []byte) (ssh.Signer, error) {
+	pub, _, _, _, err := ssh.ParseAuthorizedKey(data)
+	if err != nil {
+		return nil, err
+	}
+	cert, ok := pub.(*ssh.Certificate)
+	if !ok {
+		return nil, errors.New("not a certificate")
+	}
+	return ssh.NewCertSigner(cert, signer)
+}
+
+func (s *lazySigner) PublicKey() ssh.PublicKey {
+	return s.public
+}
+
+func (s *lazySigner) Sign(rand io.Reader, data []byte) (*ssh.Signature, error) {
+	signer, err := s.unlock()
+	if err != nil {
+		return nil, err
+	}
+	return signer.Sign(rand, data)
+}
+
+func (s *lazySigner) SignWithAlgorithm(rand io.Reader, data []byte, algorithm string) (*ssh.Signature, error) {
+	signer, err := s.unlock()
+	if err != nil {
+		return nil, err
+	}
+	algorithmSigner, ok := signer.(ssh.AlgorithmSigner)
+	if !ok {
+		return nil, fmt.Errorf("key %s can't sign with %s", s.keyFile, algorithm)
+	}
+	return algorithmSigner.SignWithAlgorithm(rand, data, algorithm)
+}
+
+// Decrypt the key, asking for its passphrase only the first time
+func (s *lazySigner) unlock() (ssh.Signer, error) {
+	s.once.Do(func() {
+		s.signer, s.err = parseEncryptedKey(s.keyFile, s.key)
+		if s.err != nil {
+			s.err = fmt.Errorf("%s: %v", s.keyFile, s.err)
+		}
+	})
+	return s.signer, s.err
+}
+
+// Ask for the passphrase on the terminal, stdin may be a pipe
+func parseEncryptedKey(keyFile string, key []byte) (ssh.Signer, error) {
+	tty, err := os.Open("/dev/tty")
+	if err != nil {
+		return nil, fmt.Errorf("key is encrypted and there's no terminal to ask for the passphrase, add it to ssh-agent instead")
+	}
+	defer tty.Close()
+
+	fmt.Fprintf(os.Stderr, "Enter passphrase for key %s: ", keyFile)
+	passphrase, err := term.ReadPassword(int(tty.Fd()))
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read passphrase: %v", err)
+	}
+
+	return ssh.ParsePrivateKeyWithPassphrase(key, passphrase)
+}
+
+// Fill in the auth chain and extra keys from ssh-auth and ssh-key-files
+func authDefaults(target *SSHTarget) {
+	if len(target.Auth) == 0 {
+		target.Auth = viper.GetStringSlice("ssh-auth")
+	}
+	if len(target.Auth) == 0 {
+		target.Auth = DefaultAuth
+	}
+	target.KeyFiles = append(target.KeyFiles, viper.GetStringSlice("ssh-key-files")...)
+}
+
+func (f *authFailures) add(format string, args ...any) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.reasons = append(f.reasons, fmt.Sprintf(format, args...))
+}
+
+// Explain an auth failure with what couldn't be used along the way
+func (f *authFailures) wrap(err error) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.reasons) == 0 || !strings.Contains(err.Error(), "unable to authenticate") {
+		return err
+	}
+	return fmt.Errorf("%w (%s)", err, strings.Join(f.reasons, "; "))
+}
@@ -0,0 +1,200 @@
+package sshlib
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+var envName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// How long a cancelled command gets to wind down before Exec returns anyway
+const closeGrace = 2 * time.Second
+
+// Run command in a new session, capturing its output and exit status.
+// Output is also streamed to opts.Stdout/Stderr if set. A non-zero exit
+// returns the result along with an error wrapping *ssh.ExitError.
+// Cancelling ctx abandons the command and closes the session.
+func (c *SSHClient) Exec(ctx context.Context, command string, opts ExecOptions) (*ExecResult, error) {
+	s, err := c.NewSession()
+	if err != nil {
+		return nil, err
+	}
+	defer s.Session.Close()
+
+	command, err = withEnv(s.Session, command, opts.Env)
+	if err != nil {
+		return nil, err
+	}
+
+	var stdout, stderr syncBuffer
+	outStream := streamWriter(opts.Stdout, opts.Prefix)
+	errStream := streamWriter(opts.Stderr, opts.Prefix)
+	s.Session.Stdout = teeWriter(&stdout, outStream)
+	s.Session.Stderr = teeWriter(&stderr, errStream)
+
+	// Copied here rather than by the session, whose Wait would otherwise
+	// block on a stdin that never ends, even after the command has
+	var stdin io.WriteCloser
+	if opts.Stdin != nil {
+		if stdin, err = s.Session.StdinPipe(); err != nil {
+			return nil, fmt.Errorf("failed to open stdin: %v", err)
+		}
+	}
+
+	start := time.Now()
+	if err := s.Session.Start(command); err != nil {
+		return nil, fmt.Errorf("failed to start command: %v", err)
+	}
+	if stdin != nil {
+		go func() {
+			io.Copy(stdin, opts.Stdin)
+			stdin.Close()
+		}()
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- s.Session.Wait() }()
+
+	abandoned := false
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		// Few servers honour signals, closing the channel is what stops the
+		// wait, unless the server never acknowledges that either
+		s.Session.Signal(ssh.SIGKILL)
+		s.Session.Close()
+		select {
+		case <-done:
+		case <-time.After(closeGrace):
+			abandoned = true
+		}
+		err = ctx.Err()
+	}
+
+	// A last line without a newline still gets its prefix. Output of an
+	// abandoned session may still be arriving, so leave its streams alone.
+	for _, stream := range []*prefixWriter{outStream, errStream} {
+		if stream != nil && !abandoned {
+			stream.Flush()
+		}
+	}
+
+	result := &ExecResult{
+		Stdout:     stdout.Bytes(),
+		Stderr:     stderr.Bytes(),
+		ExitStatus: -1,
+		Duration:   time.Since(start),
+	}
+
+	var exitErr *ssh.ExitError
+	switch {
+	case err == nil:
+		result.ExitStatus = 0
+		return result, nil
+	case errors.As(err, &exitErr):
+		result.ExitStatus = exitErr.ExitStatus()
+		result.Signal = exitErr.Signal()
+		return result, fmt.Errorf("command failed: %w", err)
+	case ctx.Err() != nil:
+		return result, fmt.Errorf("command abandoned: %w", err)
+	}
+	return result, fmt.Errorf("command failed: %w", err)
+}
+
+// Set env on the session, where the server's AcceptEnv allows, and export
+// the rest at the start of the command
+func withEnv(s *ssh.Session, command string, env map[string]string) (string, error) {
+	names := make([]string, 0, len(env))
+	for name := range env {
+		if !envName.MatchString(name) {
+			return "", fmt.Errorf("invalid environment variable name %q", name)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var exports []string
+	for _, name := range names {
+		if err := s.Setenv(name, env[name]); err != nil {
+			exports = append(exports, fmt.Sprintf("export %s=%s;", name, shellQuote(env[name])))
+		}
+	}
+	if len(exports) == 0 {
+		return command, nil
+	}
+	return strings.Join(exports, " ") + " " + command, nil
+}
+
+// Single-quote s for a POSIX shell
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+// Copy of what's been written so far
+func (b *syncBuffer) Bytes() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return bytes.Clone(b.buf.Bytes())
+}
+
+func teeWriter(capture *syncBuffer, stream *prefixWriter) io.Writer {
+	if stream == nil {
+		return capture
+	}
+	return io.MultiWriter(capture, stream)
+}
+
+// Writer streaming to w, prefixing each line when prefix is set
+func streamWriter(w io.Writer, prefix string) *prefixWriter {
+	if w == nil {
+		return nil
+	}
+	return &prefixWriter{w: w, prefix: prefix}
+}
+
+// Whole lines go out in one write each, so hosts sharing a terminal don't
+// interleave mid-line
+func (p *prefixWriter) Write(b []byte) (int, error) {
+	if p.prefix == "" {
+		return p.w.Write(b)
+	}
+
+	p.buf = append(p.buf, b...)
+	for {
+		i := bytes.IndexByte(p.buf, '\n')
+		if i < 0 {
+			break
+		}
+		line := append([]byte(p.prefix), p.buf[:i+1]...)
+		p.buf = p.buf[i+1:]
+		if _, err := p.w.Write(line); err != nil {
+			return len(b), err
+		}
+	}
+	return len(b), nil
+}
+
+func (p *prefixWriter) Flush() error {
+	if len(p.buf) == 0 {
+		return nil
+	}
+	line := append([]byte(p.prefix), p.buf...)
+	p.buf = nil
+	_, err := p.w.Write(append(line, '\n'))
+	return err
+}
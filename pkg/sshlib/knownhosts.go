@@ -0,0 +1,302 @@
+package sshlib
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/spf13/viper"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// Serializes writes to the managed file, probes connect in parallel
+var knownHostsMu sync.Mutex
+
+// lambdactl's own known_hosts, from the known-hosts-file config key, default
+// ~/.ssh/lambdactl_known_hosts. New hosts are recorded here, never in the
+// user's ~/.ssh/known_hosts.
+func ManagedKnownHostsFile() (string, error) {
+	if path := viper.GetString("known-hosts-file"); path != "" {
+		return expandHome(os.ExpandEnv(path))
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".ssh", "lambdactl_known_hosts"), nil
+}
+
+// Default host key algorithms, as x/crypto orders them
+var defaultHostKeyAlgorithms = []string{
+	ssh.CertAlgoRSASHA256v01, ssh.CertAlgoRSASHA512v01,
+	ssh.CertAlgoRSAv01, ssh.CertAlgoDSAv01, ssh.CertAlgoECDSA256v01,
+	ssh.CertAlgoECDSA384v01, ssh.CertAlgoECDSA521v01, ssh.CertAlgoED25519v01,
+
+	ssh.KeyAlgoECDSA256, ssh.KeyAlgoECDSA384, ssh.KeyAlgoECDSA521,
+	ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSASHA512,
+	ssh.KeyAlgoRSA, ssh.KeyAlgoDSA,
+
+	ssh.KeyAlgoED25519,
+}
+
+// Check host keys against ~/.ssh/known_hosts and the managed file. Unknown
+// hosts are trusted on first use and recorded, changed keys are refused
+// unless target.ReplaceHostKey is set. Like OpenSSH, the key types already
+// known for address come first in the returned host key algorithms, so the
+// server offers a key we can check.
+func hostKeyCallback(target SSHTarget, address string) (ssh.HostKeyCallback, []string, error) {
+	managed, err := ManagedKnownHostsFile()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// knownhosts.New fails on missing files, so only pass the ones there. The
+	// first key of each type wins, so the managed file goes first for
+	// --replace-host-key to take effect.
+	var files []string
+	for _, file := range []string{managed, filepath.Join(home, ".ssh", "known_hosts")} {
+		if _, err := os.Stat(file); err == nil {
+			files = append(files, file)
+		}
+	}
+
+	check := func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		return &knownhosts.KeyError{}
+	}
+	if len(files) > 0 {
+		if check, err = knownhosts.New(files...); err != nil {
+			return nil, nil, fmt.Errorf("failed to read known hosts: %v", err)
+		}
+	}
+
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		err := check(hostname, remote, key)
+
+		var keyErr *knownhosts.KeyError
+		if !errors.As(err, &keyErr) {
+			return err
+		}
+
+		// No key of this type seen, trust it and remember. Another type being
+		// known isn't a mismatch, the server just offered something else.
+		if !slices.ContainsFunc(keyErr.Want, func(known knownhosts.KnownKey) bool {
+			return known.Key.Type() == key.Type()
+		}) {
+			if err := addKnownHost(managed, hostname, key); err != nil {
+				return err
+			}
+			fmt.Fprintf(os.Stderr, "Warning: permanently added %s (%s %s) to %s\n", hostname, key.Type(), ssh.FingerprintSHA256(key), managed)
+			return nil
+		}
+
+		if target.ReplaceHostKey {
+			if err := replaceKnownHost(managed, hostname, key); err != nil {
+				return err
+			}
+			fmt.Fprintf(os.Stderr, "Warning: replaced the host key for %s with %s %s in %s\n", hostname, key.Type(), ssh.FingerprintSHA256(key), managed)
+			return nil
+		}
+
+		return &HostKeyMismatchError{Host: hostname, Key: key, Known: keyErr.Want}
+	}, hostKeyAlgorithms(check, address), nil
+}
+
+// Known key types for address first, then the defaults. Nil when nothing is
+// known, which leaves the defaults to x/crypto.
+func hostKeyAlgorithms(check ssh.HostKeyCallback, address string) []string {
+	// A key of no real type makes the check list everything known
+	var keyErr *knownhosts.KeyError
+	if !errors.As(check(address, &net.TCPAddr{}, probeKey{}), &keyErr) || len(keyErr.Want) == 0 {
+		return nil
+	}
+
+	var known []string
+	for _, want := range keyErr.Want {
+		switch keyType := want.Key.Type(); keyType {
+		case ssh.KeyAlgoRSA:
+			known = append(known, ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSA)
+		default:
+			known = append(known, keyType)
+		}
+	}
+	// Want comes out of a map
+	slices.Sort(known)
+
+	algorithms := slices.Clone(known)
+	for _, algorithm := range defaultHostKeyAlgorithms {
+		if !slices.Contains(known, algorithm) {
+			algorithms = append(algorithms, algorithm)
+		}
+	}
+	return algorithms
+}
+
+// Stand-in key for listing the known keys of a host
+type probeKey struct{}
+
+func (probeKey) Type() string { return "lambdactl-probe" }
+
+func (probeKey) Marshal() []byte { return []byte("lambdactl-probe") }
+
+func (probeKey) Verify([]byte, *ssh.Signature) error {
+	return errors.New("probe key can't verify")
+}
+
+func addKnownHost(file, hostname string, key ssh.PublicKey) error {
+	knownHostsMu.Lock()
+	defer knownHostsMu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		return fmt.Errorf("failed to record host key: %v", err)
+	}
+
+	f, err := os.OpenFile(file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to record host key: %v", err)
+	}
+	defer f.Close()
+
+	line := knownhosts.Line([]string{knownhosts.Normalize(hostname)}, key)
+	if _, err := fmt.Fprintln(f, line); err != nil {
+		return fmt.Errorf("failed to record host key: %v", err)
+	}
+	return nil
+}
+
+// Drop the managed entries for hostname and record key instead
+func replaceKnownHost(file, hostname string, key ssh.PublicKey) error {
+	host := knownhosts.Normalize(hostname)
+	if err := rewriteKnownHosts(file, func(hosts []string) bool {
+		return len(hosts) == 1 && hosts[0] == host
+	}); err != nil {
+		return err
+	}
+	return addKnownHost(file, hostname, key)
+}
+
+// Remove managed entries for ips, on any port. Lambda hands released IPs to
+// new instances, so a stale entry would look like a changed host key.
+func PruneKnownHosts(ips []string) (int, error) {
+	drop := map[string]bool{}
+	for _, ip := range ips {
+		if ip != "" {
+			drop[ip] = true
+		}
+	}
+	if len(drop) == 0 {
+		return 0, nil
+	}
+
+	file, err := ManagedKnownHostsFile()
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	err = rewriteKnownHosts(file, func(hosts []string) bool {
+		for _, host := range hosts {
+			// Normalized as ip, or [ip]:port off port 22
+			addr := host
+			if h, _, err := net.SplitHostPort(host); err == nil {
+				addr = h
+			}
+			if !drop[addr] {
+				return false
+			}
+		}
+		removed++
+		return true
+	})
+	return removed, err
+}
+
+// Rewrite the managed file without the entries drop matches. Comments, markers
+// and lines that don't parse are kept as they are.
+func rewriteKnownHosts(file string, drop func(hosts []string) bool) error {
+	knownHostsMu.Lock()
+	defer knownHostsMu.Unlock()
+
+	data, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read known hosts: %v", err)
+	}
+
+	var out bytes.Buffer
+	changed := false
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		fields := strings.Fields(line)
+		if len(fields) >= 3 && !strings.HasPrefix(fields[0], "#") && !strings.HasPrefix(fields[0], "@") && drop(strings.Split(fields[0], ",")) {
+			changed = true
+			continue
+		}
+		out.WriteString(line)
+		out.WriteByte('\n')
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read known hosts: %v", err)
+	}
+	if !changed {
+		return nil
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(file), ".lambdactl_known_hosts-*")
+	if err != nil {
+		return fmt.Errorf("failed to write known hosts: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(out.Bytes()); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write known hosts: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write known hosts: %v", err)
+	}
+
+	if err := os.Rename(tmp.Name(), file); err != nil {
+		return fmt.Errorf("failed to write known hosts: %v", err)
+	}
+	return nil
+}
+
+func expandHome(path string) (string, error) {
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		return filepath.Join(home, rest), nil
+	}
+	return path, nil
+}
+
+func (e *HostKeyMismatchError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "HOST KEY FOR %s HAS CHANGED, refusing to connect\n", e.Host)
+	fmt.Fprintf(&b, "  offered: %s %s\n", e.Key.Type(), ssh.FingerprintSHA256(e.Key))
+	for _, known := range e.Known {
+		fmt.Fprintf(&b, "  known:   %s %s (%s:%d)\n", known.Key.Type(), ssh.FingerprintSHA256(known.Key), known.Filename, known.Line)
+	}
+	b.WriteString("This is expected if the IP now belongs to a new instance, otherwise someone may be intercepting the connection.\n")
+	b.WriteString("If you trust the new key, rerun with --replace-host-key")
+	return b.String()
+}
@@ -0,0 +1,44 @@
+//go:build !(linux || darwin || dragonfly || freebsd || netbsd || openbsd)
+
+package sshlib
+
+import (
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/term"
+)
+
+// How often to check for a new size without SIGWINCH
+const resizePollInterval = 250 * time.Millisecond
+
+// No termios to copy, use the usual cooked defaults
+func terminalModes(fd int) ssh.TerminalModes {
+	return defaultTerminalModes()
+}
+
+// Forward local window size changes to the session until stopped
+func watchResize(fd int, session *ssh.Session) func() {
+	w, h, _ := term.GetSize(fd)
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(resizePollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				nw, nh, err := term.GetSize(fd)
+				if err != nil || (nw == w && nh == h) {
+					continue
+				}
+				w, h = nw, nh
+				session.WindowChange(h, w)
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
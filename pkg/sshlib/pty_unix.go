@@ -0,0 +1,93 @@
+//go:build linux || darwin || dragonfly || freebsd || netbsd || openbsd
+
+package sshlib
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/sys/unix"
+	"golang.org/x/term"
+)
+
+// Modes of the local terminal, so the remote PTY cooks input the same way.
+// Must be read before the local terminal goes raw.
+func terminalModes(fd int) ssh.TerminalModes {
+	t, err := unix.IoctlGetTermios(fd, ioctlReadTermios)
+	if err != nil {
+		return defaultTerminalModes()
+	}
+
+	lflag, iflag, oflag, cflag := uint64(t.Lflag), uint64(t.Iflag), uint64(t.Oflag), uint64(t.Cflag)
+	modes := ssh.TerminalModes{
+		ssh.ECHO:     flag(lflag, unix.ECHO),
+		ssh.ECHOE:    flag(lflag, unix.ECHOE),
+		ssh.ECHOK:    flag(lflag, unix.ECHOK),
+		ssh.ECHONL:   flag(lflag, unix.ECHONL),
+		ssh.ECHOCTL:  flag(lflag, unix.ECHOCTL),
+		ssh.ICANON:   flag(lflag, unix.ICANON),
+		ssh.ISIG:     flag(lflag, unix.ISIG),
+		ssh.IEXTEN:   flag(lflag, unix.IEXTEN),
+		ssh.ICRNL:    flag(iflag, unix.ICRNL),
+		ssh.IXON:     flag(iflag, unix.IXON),
+		ssh.IXANY:    flag(iflag, unix.IXANY),
+		ssh.IXOFF:    flag(iflag, unix.IXOFF),
+		ssh.IMAXBEL:  flag(iflag, unix.IMAXBEL),
+		ssh.OPOST:    flag(oflag, unix.OPOST),
+		ssh.ONLCR:    flag(oflag, unix.ONLCR),
+		ssh.CS8:      flag(cflag, unix.CS8),
+		ssh.PARENB:   flag(cflag, unix.PARENB),
+		ssh.VINTR:    uint32(t.Cc[unix.VINTR]),
+		ssh.VQUIT:    uint32(t.Cc[unix.VQUIT]),
+		ssh.VERASE:   uint32(t.Cc[unix.VERASE]),
+		ssh.VKILL:    uint32(t.Cc[unix.VKILL]),
+		ssh.VEOF:     uint32(t.Cc[unix.VEOF]),
+		ssh.VSTART:   uint32(t.Cc[unix.VSTART]),
+		ssh.VSTOP:    uint32(t.Cc[unix.VSTOP]),
+		ssh.VSUSP:    uint32(t.Cc[unix.VSUSP]),
+		ssh.VWERASE:  uint32(t.Cc[unix.VWERASE]),
+		ssh.VLNEXT:   uint32(t.Cc[unix.VLNEXT]),
+		ssh.VREPRINT: uint32(t.Cc[unix.VREPRINT]),
+	}
+
+	// Linux keeps the speed in the cflag bits, so the fields can be empty
+	modes[ssh.TTY_OP_ISPEED], modes[ssh.TTY_OP_OSPEED] = defaultSpeed, defaultSpeed
+	if t.Ispeed > 0 && t.Ospeed > 0 {
+		modes[ssh.TTY_OP_ISPEED], modes[ssh.TTY_OP_OSPEED] = uint32(t.Ispeed), uint32(t.Ospeed)
+	}
+	return modes
+}
+
+func flag(flags, mask uint64) uint32 {
+	if flags&mask != 0 {
+		return 1
+	}
+	return 0
+}
+
+// Forward local window size changes to the session until stopped
+func watchResize(fd int, session *ssh.Session) func() {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGWINCH)
+
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-sigs:
+				if w, h, err := term.GetSize(fd); err == nil {
+					session.WindowChange(h, w)
+				}
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(sigs)
+		close(done)
+	}
+}
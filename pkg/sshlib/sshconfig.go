@@ -0,0 +1,353 @@
+package sshlib
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// Include nesting limit, same as OpenSSH
+const maxIncludeDepth = 16
+
+// OpenSSH client config at the ssh-config key, default ~/.ssh/config. "none"
+// skips it.
+func SSHConfigFile() (string, error) {
+	if path := viper.GetString("ssh-config"); path != "" {
+		return expandHome(os.ExpandEnv(path))
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".ssh", "config"), nil
+}
+
+// Parse an OpenSSH client config. A missing file is an empty config.
+func LoadSSHConfig(path string) (*SSHConfig, error) {
+	config := &SSHConfig{}
+	if path == "none" {
+		return config, nil
+	}
+
+	// Options before the first Host apply everywhere
+	config.blocks = []*hostBlock{{patterns: []string{"*"}}}
+	if err := config.parseFile(path, 0); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read SSH config: %v", err)
+	}
+	return config, nil
+}
+
+func (c *SSHConfig) parseFile(path string, depth int) error {
+	if depth > maxIncludeDepth {
+		return fmt.Errorf("%s: includes nested too deeply", path)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		// Keyword Value, Keyword=Value or Keyword = Value
+		keyword, rest := line, ""
+		if i := strings.IndexAny(line, " \t="); i >= 0 {
+			keyword = line[:i]
+			rest = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line[i:]), "="))
+		}
+		args := splitArgs(rest)
+		if len(args) == 0 {
+			return fmt.Errorf("%s:%d: %s has no value", path, lineNo, keyword)
+		}
+
+		switch keyword = strings.ToLower(keyword); keyword {
+		case "host":
+			c.blocks = append(c.blocks, &hostBlock{patterns: args})
+		case "match":
+			// Match criteria aren't supported, never apply their options
+			c.blocks = append(c.blocks, &hostBlock{})
+		case "include":
+			for _, pattern := range args {
+				if err := c.include(pattern, depth); err != nil {
+					return err
+				}
+			}
+		default:
+			block := c.blocks[len(c.blocks)-1]
+			block.options = append(block.options, hostOption{key: keyword, values: args})
+		}
+	}
+	return scanner.Err()
+}
+
+// Relative includes are under ~/.ssh, and may be globs
+func (c *SSHConfig) include(pattern string, depth int) error {
+	pattern, err := expandHome(pattern)
+	if err != nil {
+		return err
+	}
+	if !filepath.IsAbs(pattern) {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return err
+		}
+		pattern = filepath.Join(home, ".ssh", pattern)
+	}
+
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return fmt.Errorf("bad Include pattern %q: %v", pattern, err)
+	}
+	for _, match := range matches {
+		if err := c.parseFile(match, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Words, with double quotes grouping
+func splitArgs(s string) []string {
+	var args []string
+	var b strings.Builder
+	quoted, inArg := false, false
+	for _, r := range s {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			inArg = true
+		case (r == ' ' || r == '\t') && !quoted:
+			if inArg {
+				args = append(args, b.String())
+				b.Reset()
+				inArg = false
+			}
+		default:
+			b.WriteRune(r)
+			inArg = true
+		}
+	}
+	if inArg {
+		args = append(args, b.String())
+	}
+	return args
+}
+
+// Settings for host, as typed by the user. Like OpenSSH the first value
+// found wins, except IdentityFile which accumulates.
+func (c *SSHConfig) Lookup(host string) HostConfig {
+	var hc HostConfig
+	seen := map[string]bool{}
+
+	for _, block := range c.blocks {
+		if !block.matches(host) {
+			continue
+		}
+		for _, option := range block.options {
+			if option.key == "identityfile" {
+				hc.IdentityFiles = append(hc.IdentityFiles, option.values[0])
+				continue
+			}
+			if seen[option.key] {
+				continue
+			}
+			seen[option.key] = true
+
+			value := option.values[0]
+			switch option.key {
+			case "hostname":
+				hc.HostName = value
+			case "user":
+				hc.User = value
+			case "port":
+				hc.Port, _ = strconv.Atoi(value)
+			case "proxyjump":
+				hc.ProxyJump = value
+			case "serveraliveinterval":
+				hc.ServerAliveInterval = parseSeconds(value)
+			case "serveralivecountmax":
+				hc.ServerAliveCountMax, _ = strconv.Atoi(value)
+			}
+		}
+	}
+
+	if hc.HostName != "" {
+		hc.HostName = strings.ReplaceAll(hc.HostName, "%h", host)
+		host = hc.HostName
+	}
+	for i, file := range hc.IdentityFiles {
+		hc.IdentityFiles[i] = expandTokens(file, host, hc.User)
+	}
+	return hc
+}
+
+// Seconds, or an OpenSSH time like 1m30s
+func parseSeconds(value string) time.Duration {
+	if n, err := strconv.Atoi(value); err == nil {
+		return time.Duration(n) * time.Second
+	}
+	d, _ := time.ParseDuration(strings.ToLower(value))
+	return d
+}
+
+// The %-tokens IdentityFile allows that matter here
+func expandTokens(value, host, remoteUser string) string {
+	home, _ := os.UserHomeDir()
+	localUser := ""
+	if u, err := user.Current(); err == nil {
+		localUser = u.Username
+	}
+
+	value = strings.NewReplacer(
+		"%%", "%",
+		"%d", home,
+		"%h", host,
+		"%r", remoteUser,
+		"%u", localUser,
+	).Replace(value)
+
+	if expanded, err := expandHome(value); err == nil {
+		value = expanded
+	}
+	return value
+}
+
+// Any positive pattern matches and no negated one does
+func (b *hostBlock) matches(host string) bool {
+	matched := false
+	for _, pattern := range b.patterns {
+		if negated, ok := strings.CutPrefix(pattern, "!"); ok {
+			if matchPattern(negated, host) {
+				return false
+			}
+			continue
+		}
+		if matchPattern(pattern, host) {
+			matched = true
+		}
+	}
+	return matched
+}
+
+// OpenSSH patterns: * and ? wildcards, case-insensitive
+func matchPattern(pattern, s string) bool {
+	pattern, s = strings.ToLower(pattern), strings.ToLower(s)
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for i := len(s); i >= 0; i-- {
+				if matchPattern(pattern[1:], s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(s) == 0 {
+				return false
+			}
+		default:
+			if len(s) == 0 || s[0] != pattern[0] {
+				return false
+			}
+		}
+		pattern, s = pattern[1:], s[1:]
+	}
+	return len(s) == 0
+}
+
+// Fill in unset target fields from the SSH config for its host, then from
+// ssh-user and ssh-key-file. Explicit fields, e.g. from flags, always win.
+func resolveTarget(target SSHTarget) (SSHTarget, error) {
+	path, err := SSHConfigFile()
+	if err != nil {
+		return target, err
+	}
+	config, err := LoadSSHConfig(path)
+	if err != nil {
+		return target, err
+	}
+	hc := config.Lookup(target.Host)
+
+	if hc.HostName != "" {
+		target.Host = hc.HostName
+	}
+	if target.Port == 0 {
+		target.Port = hc.Port
+	}
+	if target.Port == 0 {
+		target.Port = 22
+	}
+	if target.User == "" {
+		target.User = hc.User
+	}
+	if target.User == "" {
+		target.User = viper.GetString("ssh-user")
+	}
+	if target.User == "" {
+		target.User = "ubuntu"
+	}
+
+	// Config identities go ahead of lambdactl's default key
+	authDefaults(&target)
+	keys := hc.IdentityFiles
+	if target.KeyName == "" {
+		keyFile := viper.GetString("ssh-key-file")
+		if keyFile == "" {
+			keyFile = "id_rsa"
+		}
+		keys = append(keys, keyFile)
+	}
+	target.KeyFiles = append(keys, target.KeyFiles...)
+
+	// Flag, then ~/.ssh/config, then ssh-keepalive, so idle shells survive NAT timeouts
+	if target.KeepAlive == 0 {
+		target.KeepAlive = hc.ServerAliveInterval
+	}
+	if target.KeepAlive == 0 {
+		target.KeepAlive = DefaultKeepAlive
+		if viper.IsSet("ssh-keepalive") {
+			target.KeepAlive = viper.GetDuration("ssh-keepalive")
+		}
+	}
+	if target.KeepAliveMax == 0 {
+		target.KeepAliveMax = hc.ServerAliveCountMax
+	}
+	if target.KeepAliveMax == 0 {
+		target.KeepAliveMax = viper.GetInt("ssh-keepalive-max")
+	}
+
+	// Flag, then ~/.ssh/config, then ssh-jump. ssh-jump is meant for
+	// instances, so hops only follow their own ProxyJump.
+	if target.Jumps == nil {
+		spec := hc.ProxyJump
+		if spec == "" && !target.isJump {
+			spec = viper.GetString("ssh-jump")
+		}
+		switch spec {
+		case "":
+		case "none":
+			// Explicitly direct, ssh-jump doesn't apply either
+			target.Jumps = []SSHTarget{}
+		default:
+			if target.Jumps, err = ParseJumps(spec); err != nil {
+				return target, err
+			}
+		}
+	}
+
+	return target, nil
+}
@@ -0,0 +1,269 @@
+package sshlib
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Write files under a fresh HOME, config content goes in ~/.ssh/config
+func writeSSHConfig(t *testing.T, files map[string]string) string {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	for name, content := range files {
+		path := filepath.Join(home, ".ssh", name)
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return home
+}
+
+func TestSSHConfigLookup(t *testing.T) {
+	home := writeSSHConfig(t, map[string]string{
+		"config": `
+# Global options apply everywhere
+ServerAliveCountMax 5
+
+Host bastion
+  HostName 203.0.113.10
+  User admin
+  Port 2222
+  ProxyJump none
+
+Host train-* !train-secret
+  User=ubuntu
+  IdentityFile ~/.ssh/train
+  ProxyJump bastion
+  ServerAliveInterval 1m30s
+
+Host "quoted host"
+  HostName %h.example.com
+
+Host *.internal
+  HostName %h
+  IdentityFile %d/.ssh/%h-%r
+  User ops
+
+Match host foo
+  User ignored
+
+Include conf.d/*
+
+Host *
+  IdentityFile ~/.ssh/default
+  User fallback
+  ServerAliveInterval 15
+`,
+		"conf.d/extra": `
+Host included
+  Port = 2200
+`,
+	})
+
+	config, err := LoadSSHConfig(filepath.Join(home, ".ssh", "config"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		host string
+		want HostConfig
+	}{
+		{"bastion", HostConfig{
+			HostName: "203.0.113.10", User: "admin", Port: 2222, ProxyJump: "none",
+			IdentityFiles:       []string{filepath.Join(home, ".ssh", "default")},
+			ServerAliveInterval: 15 * time.Second, ServerAliveCountMax: 5,
+		}},
+		{"train-1", HostConfig{
+			User: "ubuntu", ProxyJump: "bastion",
+			IdentityFiles:       []string{filepath.Join(home, ".ssh", "train"), filepath.Join(home, ".ssh", "default")},
+			ServerAliveInterval: 90 * time.Second, ServerAliveCountMax: 5,
+		}},
+		{"TRAIN-2", HostConfig{
+			User: "ubuntu", ProxyJump: "bastion",
+			IdentityFiles:       []string{filepath.Join(home, ".ssh", "train"), filepath.Join(home, ".ssh", "default")},
+			ServerAliveInterval: 90 * time.Second, ServerAliveCountMax: 5,
+		}},
+		{"train-secret", HostConfig{
+			User:                "fallback",
+			IdentityFiles:       []string{filepath.Join(home, ".ssh", "default")},
+			ServerAliveInterval: 15 * time.Second, ServerAliveCountMax: 5,
+		}},
+		{"quoted host", HostConfig{
+			HostName: "quoted host.example.com", User: "fallback",
+			IdentityFiles:       []string{filepath.Join(home, ".ssh", "default")},
+			ServerAliveInterval: 15 * time.Second, ServerAliveCountMax: 5,
+		}},
+		{"db.internal", HostConfig{
+			HostName: "db.internal", User: "ops",
+			IdentityFiles:       []string{filepath.Join(home, ".ssh", "db.internal-ops"), filepath.Join(home, ".ssh", "default")},
+			ServerAliveInterval: 15 * time.Second, ServerAliveCountMax: 5,
+		}},
+		{"foo", HostConfig{
+			User:                "fallback",
+			IdentityFiles:       []string{filepath.Join(home, ".ssh", "default")},
+			ServerAliveInterval: 15 * time.Second, ServerAliveCountMax: 5,
+		}},
+		{"included", HostConfig{
+			Port: 2200, User: "fallback",
+			IdentityFiles:       []string{filepath.Join(home, ".ssh", "default")},
+			ServerAliveInterval: 15 * time.Second, ServerAliveCountMax: 5,
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			if got := config.Lookup(tt.host); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Lookup(%q) = %+v, want %+v", tt.host, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadSSHConfigEmpty(t *testing.T) {
+	home := writeSSHConfig(t, nil)
+
+	for _, path := range []string{"none", filepath.Join(home, ".ssh", "missing")} {
+		config, err := LoadSSHConfig(path)
+		if err != nil {
+			t.Fatalf("LoadSSHConfig(%q): %v", path, err)
+		}
+		if got := config.Lookup("anything"); !reflect.DeepEqual(got, HostConfig{}) {
+			t.Errorf("LoadSSHConfig(%q).Lookup = %+v, want nothing set", path, got)
+		}
+	}
+}
+
+func TestLoadSSHConfigErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  string
+	}{
+		{"keyword without value", map[string]string{"config": "Host a\n  User\n"}, "config:2: User has no value"},
+		{"host without patterns", map[string]string{"config": "Host\n"}, "config:1: Host has no value"},
+		{"include loop", map[string]string{"config": "Include config\n"}, "nested too deeply"},
+		{"error in include", map[string]string{"config": "Include other\n", "other": "\n\nPort\n"}, "other:3: Port has no value"},
+		{"bad include glob", map[string]string{"config": "Include [\n"}, "bad Include pattern"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			home := writeSSHConfig(t, tt.files)
+			_, err := LoadSSHConfig(filepath.Join(home, ".ssh", "config"))
+			if err == nil {
+				t.Fatalf("LoadSSHConfig succeeded, want error containing %q", tt.want)
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("LoadSSHConfig error = %q, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitArgs(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"", nil},
+		{"one", []string{"one"}},
+		{"one  two\tthree", []string{"one", "two", "three"}},
+		{`"with space" plain`, []string{"with space", "plain"}},
+		{`""`, []string{""}},
+		{`pre"fix mid"post`, []string{"prefix midpost"}},
+	}
+
+	for _, tt := range tests {
+		if got := splitArgs(tt.in); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitArgs(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestMatchPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		host    string
+		want    bool
+	}{
+		{"*", "anything", true},
+		{"*", "", true},
+		{"host", "host", true},
+		{"host", "HOST", true},
+		{"host", "hostname", false},
+		{"train-*", "train-1", true},
+		{"train-*", "train-", true},
+		{"train-*", "infer-1", false},
+		{"train-?", "train-1", true},
+		{"train-?", "train-12", false},
+		{"*.internal", "db.internal", true},
+		{"*.internal", "db.internal.example", false},
+		{"10.0.*.1", "10.0.200.1", true},
+		{"*a*b", "xaxxb", true},
+	}
+
+	for _, tt := range tests {
+		if got := matchPattern(tt.pattern, tt.host); got != tt.want {
+			t.Errorf("matchPattern(%q, %q) = %v, want %v", tt.pattern, tt.host, got, tt.want)
+		}
+	}
+}
+
+func TestParseSeconds(t *testing.T) {
+	tests := []struct {
+		in   string
+		want time.Duration
+	}{
+		{"30", 30 * time.Second},
+		{"0", 0},
+		{"1m30s", 90 * time.Second},
+		{"2M", 2 * time.Minute},
+		{"bogus", 0},
+	}
+
+	for _, tt := range tests {
+		if got := parseSeconds(tt.in); got != tt.want {
+			t.Errorf("parseSeconds(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseJumps(t *testing.T) {
+	tests := []struct {
+		spec string
+		want []SSHTarget
+	}{
+		{"none", []SSHTarget{}},
+		{"bastion", []SSHTarget{{Host: "bastion"}}},
+		{"admin@bastion:2222", []SSHTarget{{Host: "bastion", User: "admin", Port: 2222}}},
+		{"ssh://a, b@c", []SSHTarget{{Host: "a"}, {Host: "c", User: "b"}}},
+		{"[2001:db8::1]:22", []SSHTarget{{Host: "2001:db8::1", Port: 22}}},
+		{"a,,b", []SSHTarget{{Host: "a"}, {Host: "b"}}},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseJumps(tt.spec)
+		if err != nil {
+			t.Errorf("ParseJumps(%q): %v", tt.spec, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseJumps(%q) = %+v, want %+v", tt.spec, got, tt.want)
+		}
+	}
+
+	for _, spec := range []string{"bastion:0", "bastion:99999", "bastion:ssh", "user@"} {
+		if _, err := ParseJumps(spec); err == nil {
+			t.Errorf("ParseJumps(%q) succeeded, want an error", spec)
+		}
+	}
+}
@@ -1,10 +1,14 @@
 package sshlib
 
 import (
+	"context"
 	"fmt"
 	"io"
+	"net"
 	"os"
-	"path"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/pkg/sftp"
@@ -12,39 +16,223 @@ import (
 	"golang.org/x/term"
 )
 
-// Return new client for target
+// Return new client for target, through its jump hosts if it has any
 func NewSSHClient(target SSHTarget) (*SSHClient, error) {
-	// TODO: Wire in viper for user/port defaults
-	if target.Port == 0 {
-		target.Port = 22
+	route, err := resolveRoute(target, nil)
+	if err != nil {
+		return nil, err
+	}
+	target, jumps := route[len(route)-1], route[:len(route)-1]
+
+	// Each hop is dialed through the one before it
+	var hops []*ssh.Client
+	closeHops := func() {
+		for i := len(hops) - 1; i >= 0; i-- {
+			hops[i].Close()
+		}
 	}
-	if target.User == "" {
-		target.User = "ubuntu"
+
+	var via *ssh.Client
+	for _, jump := range jumps {
+		hop, err := dialTarget(jump, via)
+		if err != nil {
+			closeHops()
+			return nil, fmt.Errorf("failed to connect to jump host %s: %w", jump.Host, err)
+		}
+		hops = append(hops, hop)
+		via = hop
 	}
 
-	// TODO: Use viper here -- privateKeyFile := os.ExpandEnv(viper.GetString("privateKey"))
-	key, err := os.ReadFile(path.Join(os.ExpandEnv("$HOME/.ssh"), target.KeyName))
+	client, err := dialTarget(target, via)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open private key: %v", err)
+		closeHops()
+		return nil, err
+	}
+
+	// Callers only close the final client, take the hops down with it
+	if len(hops) > 0 {
+		go func() {
+			client.Wait()
+			closeHops()
+		}()
 	}
+	return &SSHClient{Client: client}, nil
+}
 
-	signer, err := ssh.ParsePrivateKey(key)
+// Resolve target and the hops in front of it, in dialing order with target
+// last. As with ssh -J, the first hop follows its own ProxyJump and later ones
+// go through the hop before. seen holds the addresses already on the route.
+func resolveRoute(target SSHTarget, seen []string) ([]SSHTarget, error) {
+	target, err := resolveTarget(target)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse private key: %v", err)
+		return nil, err
+	}
+
+	address := net.JoinHostPort(target.Host, strconv.Itoa(target.Port))
+	if len(seen) > 0 && seen[len(seen)-1] == address {
+		// A Host * ProxyJump reaching the bastion itself, which is direct
+		return nil, nil
+	}
+	if slices.Contains(seen, address) {
+		return nil, fmt.Errorf("jump hosts loop back to %s", address)
+	}
+	seen = append(seen, address)
+
+	var route []SSHTarget
+	for i, jump := range target.Jumps {
+		jump.ReplaceHostKey = target.ReplaceHostKey
+		jump.isJump = true
+		if i > 0 {
+			jump.Jumps = []SSHTarget{}
+		}
+
+		hops, err := resolveRoute(jump, seen)
+		if err != nil {
+			return nil, err
+		}
+		route = append(route, hops...)
+	}
+	return append(route, target), nil
+}
+
+// Connect and authenticate to a resolved target, directly or through via
+func dialTarget(target SSHTarget, via *ssh.Client) (*ssh.Client, error) {
+	auth, closeAuth, failures, err := authMethods(target)
+	if err != nil {
+		return nil, err
+	}
+	defer closeAuth()
+
+	address := net.JoinHostPort(target.Host, strconv.Itoa(target.Port))
+
+	hostKeys, hostKeyAlgorithms, err := hostKeyCallback(target, address)
+	if err != nil {
+		return nil, err
 	}
 
 	config := &ssh.ClientConfig{
-		User: target.User,
-		Auth: []ssh.AuthMethod{
-			ssh.PublicKeys(signer),
-		},
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(), // TODO: Maybe warn on this
-		Timeout:         5 * time.Second,             // TODO: Make adjustble?
+		User:              target.User,
+		Auth:              auth,
+		HostKeyCallback:   hostKeys,
+		HostKeyAlgorithms: hostKeyAlgorithms,
+		Timeout:           5 * time.Second, // TODO: Make adjustble?
+	}
+
+	var client *ssh.Client
+	if via == nil {
+		client, err = ssh.Dial("tcp", address, config)
+	} else {
+		client, err = dialVia(via, address, config)
+	}
+	if err != nil {
+		return nil, failures.wrap(err)
+	}
+
+	if target.KeepAlive > 0 {
+		go keepAlive(client, target.KeepAlive, target.KeepAliveMax)
+	}
+	return client, nil
+}
+
+// SSH handshake over a direct-tcpip channel of an existing connection
+func dialVia(via *ssh.Client, address string, config *ssh.ClientConfig) (*ssh.Client, error) {
+	conn, err := via.Dial("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	c, chans, reqs, err := ssh.NewClientConn(conn, address, config)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return ssh.NewClient(c, chans, reqs), nil
+}
+
+// Parse a ProxyJump-style chain, [user@]host[:port] separated by commas.
+// "none" is an explicitly empty chain.
+func ParseJumps(spec string) ([]SSHTarget, error) {
+	jumps := []SSHTarget{}
+	if spec == "none" {
+		return jumps, nil
 	}
 
-	address := fmt.Sprintf("%s:%d", target.Host, target.Port)
-	client, err := ssh.Dial("tcp", address, config)
-	return &SSHClient{Client: client, PubKey: signer.PublicKey()}, err
+	for _, hop := range strings.Split(spec, ",") {
+		hop = strings.TrimPrefix(strings.TrimSpace(hop), "ssh://")
+		if hop == "" {
+			continue
+		}
+
+		var jump SSHTarget
+		if user, host, found := strings.Cut(hop, "@"); found {
+			jump.User, hop = user, host
+		}
+
+		jump.Host = hop
+		if host, port, err := net.SplitHostPort(hop); err == nil {
+			n, err := strconv.Atoi(port)
+			if err != nil || n <= 0 || n > 65535 {
+				return nil, fmt.Errorf("invalid port in jump host %q", hop)
+			}
+			jump.Host, jump.Port = host, n
+		}
+		if jump.Host == "" {
+			return nil, fmt.Errorf("invalid jump host %q", hop)
+		}
+
+		jumps = append(jumps, jump)
+	}
+	return jumps, nil
+}
+
+// Keepalive interval when neither ~/.ssh/config nor ssh-keepalive set one
+const DefaultKeepAlive = 30 * time.Second
+
+// Probe the server every interval and drop the connection once maxMissed
+// probes in a row go unanswered, like OpenSSH's ServerAliveInterval
+func keepAlive(client *ssh.Client, interval time.Duration, maxMissed int) {
+	if maxMissed <= 0 {
+		maxMissed = 3
+	}
+
+	done := make(chan struct{})
+	go func() {
+		client.Wait()
+		close(done)
+	}()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	missed := 0
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+
+		replied := make(chan error, 1)
+		go func() {
+			_, _, err := client.SendRequest("keepalive@openssh.com", true, nil)
+			replied <- err
+		}()
+
+		select {
+		case <-done:
+			return
+		case err := <-replied:
+			if err != nil {
+				return
+			}
+			missed = 0
+		case <-time.After(interval):
+			if missed++; missed >= maxMissed {
+				client.Close()
+				return
+			}
+		}
+	}
 }
 
 // New session for connected client
@@ -86,20 +274,25 @@ func (c *SSHExecCommand) Run() error {
 
 // Interactive shell on session
 func (s *SSHSession) Shell() error {
+	fd := int(os.Stdin.Fd())
+
 	// Set the pipes for stdin, stdout, and stderr
 	s.Session.Stdin = os.Stdin
 	s.Session.Stdout = os.Stdout
 	s.Session.Stderr = os.Stderr
 
+	// Copy the local modes before going raw clears them
+	modes := terminalModes(fd)
+
 	// Make input raw
-	oldState, err := term.MakeRaw(int(os.Stdin.Fd()))
+	oldState, err := term.MakeRaw(fd)
 	if err != nil {
 		return fmt.Errorf("failed to make terminal raw: %v", err)
 	}
-	defer term.Restore(int(os.Stdin.Fd()), oldState)
+	defer term.Restore(fd, oldState)
 
 	// Grab current size and terminal profile
-	w, h, err := term.GetSize(int(os.Stdin.Fd()))
+	w, h, err := term.GetSize(fd)
 	if err != nil {
 		return fmt.Errorf("failed to get terminal size: %v", err)
 	}
@@ -110,7 +303,7 @@ func (s *SSHSession) Shell() error {
 	}
 
 	// Ask for a matching new PTY
-	if err = s.Session.RequestPty(term, h, w, ssh.TerminalModes{}); err != nil {
+	if err = s.Session.RequestPty(term, h, w, modes); err != nil {
 		return fmt.Errorf("failed to request PTY on remote s: %v", err)
 	}
 
@@ -119,18 +312,34 @@ func (s *SSHSession) Shell() error {
 		return fmt.Errorf("failed to launch remote shell: %v", err)
 	}
 
+	// Keep full-screen programs in step with the local window
+	stopResize := watchResize(fd, s.Session)
+	defer stopResize()
+
 	// Block until it returns
 	return s.Session.Wait()
 }
 
-// All in one interactive shell
-func NewShell(host string, port int, user string, keyName string) error {
-	target := SSHTarget{
-		Host:    host,
-		KeyName: keyName,
-		Port:    port,
-		User:    user,
+// Speed reported when the local terminal doesn't say
+const defaultSpeed = 38400
+
+// Cooked mode as a fresh terminal would have it
+func defaultTerminalModes() ssh.TerminalModes {
+	return ssh.TerminalModes{
+		ssh.ECHO:          1,
+		ssh.ICANON:        1,
+		ssh.ISIG:          1,
+		ssh.ICRNL:         1,
+		ssh.OPOST:         1,
+		ssh.ONLCR:         1,
+		ssh.CS8:           1,
+		ssh.TTY_OP_ISPEED: defaultSpeed,
+		ssh.TTY_OP_OSPEED: defaultSpeed,
 	}
+}
+
+// All in one interactive shell
+func NewShell(target SSHTarget) error {
 	c, err := NewSSHClient(target)
 	if err != nil {
 		return err
@@ -146,24 +355,19 @@ func NewShell(host string, port int, user string, keyName string) error {
 	return s.Shell()
 }
 
-// Run command in new session
+// Run command in new session, streaming its output
 func (c *SSHClient) Run(command string) error {
-	s, err := c.NewSession()
-	if err != nil {
-		return fmt.Errorf("error creating new session: %v", err)
-	}
-	defer s.Session.Close()
-
-	// Set up I/O for the command (stdout, stderr)
-	s.Session.Stdout = os.Stdout
-	s.Session.Stderr = os.Stderr
+	_, err := c.Exec(context.Background(), command, ExecOptions{Stdout: os.Stdout, Stderr: os.Stderr})
+	return err
+}
 
-	// Run the command
-	if err := s.Session.Run(command); err != nil {
-		return fmt.Errorf("failed to run command: %v", err)
+// Run command in new session and return its stdout
+func (c *SSHClient) Output(command string) ([]byte, error) {
+	result, err := c.Exec(context.Background(), command, ExecOptions{})
+	if result == nil {
+		return nil, err
 	}
-
-	return nil
+	return result.Stdout, err
 }
 
 // NewSFTPClient creates and returns an SFTP client from an existing SSH connection
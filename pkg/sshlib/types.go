@@ -1,15 +1,18 @@
 package sshlib
 
 import (
+	"bytes"
 	"io"
+	"sync"
+	"time"
 
 	"github.com/pkg/sftp"
 	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
 )
 
 type SSHClient struct {
 	Client *ssh.Client
-	PubKey ssh.PublicKey
 }
 type SSHSession struct {
 	Session *ssh.Session
@@ -27,10 +30,99 @@ type SSHExecCommand struct {
 }
 
 type SSHTarget struct {
-	Host    string // IP or Hostname
-	KeyName string // Default id_rsa
-	Port    int    // Default 22
-	User    string // Default ubuntu
+	Host    string // IP, hostname or ~/.ssh/config alias
+	KeyName string // Name under ~/.ssh or a path, default ~/.ssh/config's then ssh-key-file
+	Port    int    // Default ~/.ssh/config's, else 22
+	User    string // Default ~/.ssh/config's, else ssh-user, else ubuntu
+
+	KeyFiles       []string // More keys to try, ahead of ssh-key-files
+	Auth           []string // Auth methods in order, default ssh-auth or agent then keys
+	ReplaceHostKey bool     // Accept and record a changed host key
+
+	Jumps  []SSHTarget // Hops to dial through in order, nil for ~/.ssh/config's ProxyJump or ssh-jump
+	isJump bool        // Resolving a hop, so only ~/.ssh/config's ProxyJump applies
+
+	KeepAlive    time.Duration // Interval between keepalives, 0 for the default, negative disables them
+	KeepAliveMax int           // Unanswered keepalives before disconnecting, default 3
+}
+
+// Parsed OpenSSH client config
+type SSHConfig struct {
+	blocks []*hostBlock
+}
+
+type hostBlock struct {
+	patterns []string
+	options  []hostOption
+}
+
+type hostOption struct {
+	key    string // Lowercased keyword
+	values []string
+}
+
+// What the OpenSSH config says about one host
+type HostConfig struct {
+	HostName            string
+	User                string
+	Port                int
+	IdentityFiles       []string
+	ProxyJump           string
+	ServerAliveInterval time.Duration
+	ServerAliveCountMax int
+}
+
+// Why auth methods couldn't contribute, for a useful error if all fail
+type authFailures struct {
+	mu      sync.Mutex
+	reasons []string
+}
+
+// Encrypted key, decrypted the first time it has to sign
+type lazySigner struct {
+	public  ssh.PublicKey
+	keyFile string
+	key     []byte
+	once    sync.Once
+	signer  ssh.Signer
+	err     error
+}
+
+// Host offered a key that doesn't match the recorded one
+type HostKeyMismatchError struct {
+	Host  string
+	Key   ssh.PublicKey
+	Known []knownhosts.KnownKey
+}
+
+// How to run a command with Exec
+type ExecOptions struct {
+	Stdin  io.Reader         // Fed to the command, default none
+	Env    map[string]string // Set through the session, or exported if the server refuses
+	Stdout io.Writer         // Stream output here as well as capturing it
+	Stderr io.Writer
+	Prefix string // Put in front of every streamed line, e.g. "host: "
+}
+
+// What a command did
+type ExecResult struct {
+	Stdout     []byte
+	Stderr     []byte
+	ExitStatus int    // -1 if it never reported one, e.g. on cancellation
+	Signal     string // Set if killed by a signal
+	Duration   time.Duration
+}
+
+// Output capture that can be read while a session still writes to it
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+type prefixWriter struct {
+	w      io.Writer
+	prefix string
+	buf    []byte // Partial line waiting for its newline
 }
 
 type SSHStreams struct {
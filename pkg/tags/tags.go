@@ -0,0 +1,214 @@
+package tags
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"lambdactl/pkg/api"
+
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+// How long to wait for another run's lock, and when to assume it crashed
+const (
+	lockTimeout = 5 * time.Second
+	lockStale   = 30 * time.Second
+)
+
+// Store location from the tag-store config key, default ~/.lambda-tags.yaml.
+// Instance IDs belong to an account, so each profile gets its own store next
+// to it, e.g. ~/.lambda-tags-research.yaml.
+func DefaultPath() (string, error) {
+	path := viper.GetString("tag-store")
+	if path != "" {
+		path = os.ExpandEnv(path)
+	} else {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		path = filepath.Join(home, ".lambda-tags.yaml")
+	}
+
+	if profile := viper.GetString("profile"); profile != "" {
+		ext := filepath.Ext(path)
+		path = strings.TrimSuffix(path, ext) + "-" + profile + ext
+	}
+	return path, nil
+}
+
+// Load the store at path, a missing file is an empty store
+func Load(path string) (*Store, error) {
+	store := &Store{path: path, Instances: map[string]map[string]string{}}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tag store: %v", err)
+	}
+
+	if err := yaml.Unmarshal(data, store); err != nil {
+		return nil, fmt.Errorf("failed to parse tag store %s: %v", path, err)
+	}
+	if store.Instances == nil {
+		store.Instances = map[string]map[string]string{}
+	}
+
+	return store, nil
+}
+
+// Open the store for reading
+func Open() (*Store, error) {
+	path, err := DefaultPath()
+	if err != nil {
+		return nil, err
+	}
+	return Load(path)
+}
+
+// Apply change to the store as it is on disk and save it. A lock file keeps
+// concurrent runs from overwriting each other's changes.
+func Update(change func(s *Store)) error {
+	path, err := DefaultPath()
+	if err != nil {
+		return err
+	}
+
+	unlock, err := lock(path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	store, err := Load(path)
+	if err != nil {
+		return err
+	}
+	change(store)
+	return store.Save()
+}
+
+// Take path.lock, breaking it if its holder looks to have died
+func lock(path string) (func(), error) {
+	lockFile := path + ".lock"
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		f, err := os.OpenFile(lockFile, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(lockFile) }, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, fmt.Errorf("failed to lock tag store: %v", err)
+		}
+
+		if info, err := os.Stat(lockFile); err == nil && time.Since(info.ModTime()) > lockStale {
+			os.Remove(lockFile)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("tag store is locked by another run, remove %s if none is running", lockFile)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// Write the store back, replacing the file atomically
+func (s *Store) Save() error {
+	data, err := yaml.Marshal(s)
+	if err != nil {
+		return fmt.Errorf("failed to marshal tag store: %v", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), ".lambda-tags-*")
+	if err != nil {
+		return fmt.Errorf("failed to write tag store: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write tag store: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write tag store: %v", err)
+	}
+
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("failed to write tag store: %v", err)
+	}
+	return nil
+}
+
+func (s *Store) Get(id string) map[string]string {
+	return s.Instances[id]
+}
+
+func (s *Store) Set(id, key, value string) {
+	if s.Instances[id] == nil {
+		s.Instances[id] = map[string]string{}
+	}
+	s.Instances[id][key] = value
+}
+
+func (s *Store) Remove(id, key string) {
+	delete(s.Instances[id], key)
+	if len(s.Instances[id]) == 0 {
+		delete(s.Instances, id)
+	}
+}
+
+func (s *Store) Delete(id string) {
+	delete(s.Instances, id)
+}
+
+// Drop tags for instances seen terminated, returning how many went. Instances
+// missing from a listing may just be too new to show up, so they're kept.
+func (s *Store) Prune(instances []api.InstanceDetails) int {
+	pruned := 0
+	for _, instance := range instances {
+		if _, ok := s.Instances[instance.ID]; ok && instance.Status == api.StatusTerminated {
+			delete(s.Instances, instance.ID)
+			pruned++
+		}
+	}
+	return pruned
+}
+
+// Fill in the Tags of each instance from the store
+func (s *Store) Annotate(instances []api.InstanceDetails) {
+	for i := range instances {
+		instances[i].Tags = s.Instances[instances[i].ID]
+	}
+}
+
+// Parse key=value pairs, rejecting empty keys
+func ParseTags(pairs []string) (map[string]string, error) {
+	parsed := map[string]string{}
+	for _, pair := range pairs {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid tag %q, expected key=value", pair)
+		}
+		parsed[key] = value
+	}
+	return parsed, nil
+}
+
+// Tags as sorted key=value pairs joined by commas
+func Format(tags map[string]string) string {
+	pairs := make([]string, 0, len(tags))
+	for key, value := range tags {
+		pairs = append(pairs, key+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
@@ -0,0 +1,7 @@
+package tags
+
+// Local labels for instances, keyed by instance ID, since the API has no tags
+type Store struct {
+	path      string
+	Instances map[string]map[string]string `yaml:"instances"`
+}
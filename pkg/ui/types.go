@@ -1,10 +1,14 @@
 package ui
 
 import (
+	"context"
 	"lambdactl/pkg/api"
+	"lambdactl/pkg/filter"
 	"time"
 
 	"github.com/charmbracelet/bubbles/table"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/huh"
 	"github.com/charmbracelet/lipgloss"
 )
@@ -40,20 +44,29 @@ var (
 )
 
 type Model struct {
+	ctx             context.Context
 	client          *api.APIClient
 	machines        []api.InstanceDetails
 	selectedMachine *api.InstanceDetails
 	options         []api.InstanceOption
 	selectedOption  *api.InstanceOption
+	visibleMachines []api.InstanceDetails
 	filter          string
+	instanceFilter  filter.Filter
+	filterInput     textinput.Model
+	filtering       bool
 	runningTable    table.Model
 	optionTable     table.Model
 	launchForm      huh.Form
+	confirmRestart  bool
+	progress        string
+	waits           int // Launches still being waited on
 	currentState    string
 	previousState   string
 	errorMsg        string
 	refreshInterval time.Duration
 	errorTimeout    time.Duration
+	waitTimeout     time.Duration // Give up on a launch that isn't up by then
 }
 
 type errMsg struct {
@@ -78,4 +91,22 @@ type optionsMsg struct {
 	options []api.InstanceOption
 }
 
+type launchedMsg struct {
+	ids []string
+}
+
+// Carries its launch's channel, so concurrent launches don't share one
+type progressMsg struct {
+	event api.WaitEvent
+	ch    <-chan tea.Msg
+}
+
+type waitDoneMsg struct {
+	err error
+}
+
+type restartMsg struct {
+	instances []api.InstanceDetails
+}
+
 type timerMsg struct{}
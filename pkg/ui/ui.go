@@ -1,27 +1,47 @@
 package ui
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"os"
 	"sort"
 	"strings"
 	"time"
 
 	"lambdactl/pkg/api"
+	"lambdactl/pkg/filter"
+	"lambdactl/pkg/secrets"
 	"lambdactl/pkg/sshlib"
+	"lambdactl/pkg/tags"
 	"lambdactl/pkg/utils"
 
 	"github.com/charmbracelet/bubbles/table"
+	"github.com/charmbracelet/bubbles/textinput"
 	tea "github.com/charmbracelet/bubbletea"
-	"github.com/charmbracelet/huh"
 	"github.com/charmbracelet/lipgloss"
 	"github.com/spf13/viper"
 )
 
-func NewModel() *Model {
-	client := api.NewAPIClient(
+func NewModel(ctx context.Context, filterExpr string) (*Model, error) {
+	instanceFilter, err := filter.Parse(filterExpr)
+	if err != nil {
+		return nil, err
+	}
+
+	apiKey, err := secrets.SourceFromConfig().Resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := api.NewAPIClient(
 		viper.GetString("api-url"),
-		viper.GetString("api-key"),
+		apiKey,
+		api.ConfigOptions()...,
 	)
+	if err != nil {
+		return nil, err
+	}
 
 	styles := table.Styles{
 		Header: lipgloss.NewStyle().
@@ -47,6 +67,7 @@ func NewModel() *Model {
 		{Title: "Memory", Width: 8},
 		{Title: "Storage", Width: 10},
 		{Title: "Status", Width: 10},
+		{Title: "Tags", Width: 25},
 	}
 
 	optionColumns := []table.Column{
@@ -71,15 +92,25 @@ func NewModel() *Model {
 	)
 	optionTable.SetStyles(styles)
 
+	filterInput := textinput.New()
+	filterInput.Prompt = "Filter: "
+	filterInput.Placeholder = "status=active,region=us-east-1,gpus>=8,name~train-*"
+	filterInput.SetValue(filterExpr)
+
 	return &Model{
+		ctx:             ctx,
+		filter:          filterExpr,
+		instanceFilter:  instanceFilter,
+		filterInput:     filterInput,
 		client:          client,
 		refreshInterval: 30 * time.Second,
 		errorTimeout:    5 * time.Second,
+		waitTimeout:     20 * time.Minute,
 		currentState:    runningState,
 		runningTable:    runningTable,
 		optionTable:     optionTable,
 		// launchForm:      *launchForm,
-	}
+	}, nil
 }
 
 func (m Model) Init() tea.Cmd {
@@ -98,10 +129,16 @@ func (m Model) startTimer(interval time.Duration, msg any) tea.Cmd {
 
 func (m Model) refreshInstances() tea.Cmd {
 	return func() tea.Msg {
-		instances, err := m.client.ListInstances()
+		instances, err := m.client.ListInstances(m.ctx)
+		if err != nil {
+			return errMsg{err}
+		}
+
+		store, err := tags.Open()
 		if err != nil {
 			return errMsg{err}
 		}
+		store.Annotate(instances)
 
 		return instancesMsg{instances}
 	}
@@ -109,7 +146,7 @@ func (m Model) refreshInstances() tea.Cmd {
 
 func (m Model) refreshOptions() tea.Cmd {
 	return func() tea.Msg {
-		options, err := m.client.FetchInstanceOptions()
+		options, err := m.client.FetchInstanceOptions(m.ctx)
 		if err != nil {
 			return errMsg{err}
 		}
@@ -123,11 +160,31 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case errMsg:
 		if msg.err != nil {
 			m.errorMsg = msg.err.Error()
+			if suggestion := api.Suggestion(msg.err); suggestion != "" {
+				m.errorMsg += "\n" + suggestion
+			}
 			return m, m.startTimer(m.errorTimeout, clearErrMsg{})
 		}
 		return m, nil
 	case clearErrMsg:
 		m.errorMsg = ""
+	// Launch progress arrives regardless of the current view
+	case launchedMsg:
+		ch := make(chan tea.Msg)
+		m.waits++
+		m.progress = fmt.Sprintf("Launched %d instance(s), waiting for them to boot...", len(msg.ids))
+		return m, tea.Batch(m.waitCmd(msg.ids, ch), nextProgress(ch), m.refreshInstances())
+	case progressMsg:
+		m.progress = fmt.Sprintf("Booting %d/%d ready, %s is %s", msg.event.Ready, msg.event.Total, msg.event.Instance.Label(), msg.event.Instance.Status)
+		return m, tea.Batch(nextProgress(msg.ch), m.refreshInstances())
+	case waitDoneMsg:
+		if m.waits--; m.waits == 0 {
+			m.progress = ""
+		}
+		if msg.err != nil {
+			return m, func() tea.Msg { return errMsg{msg.err} }
+		}
+		return m, m.refreshInstances()
 	}
 	switch m.currentState {
 	case runningState:
@@ -147,16 +204,58 @@ func (m Model) updateRunningState(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
 	case instancesMsg:
 		m.machines = msg.instances
-		m.runningTable.SetRows(machineSliceToTableRows(m.machines))
+		m.applyFilter()
+		return m, nil
+	case filterMsg:
+		parsed, err := filter.Parse(msg.filter)
+		if err == nil {
+			err = parsed.Check(api.IsInstanceField)
+		}
+		if err != nil {
+			return m, func() tea.Msg { return errMsg{err} }
+		}
+		m.filter = msg.filter
+		m.instanceFilter = parsed
+		m.applyFilter()
 		return m, nil
 	case timerMsg:
 		return m, tea.Batch(m.refreshInstances(), m.startTimer(m.refreshInterval, timerMsg{}))
 	case tea.KeyMsg:
+		// Filter input swallows keys until submitted or cancelled
+		if m.filtering {
+			switch msg.String() {
+			case "enter":
+				m.filtering = false
+				m.filterInput.Blur()
+				m.runningTable.Focus()
+				value := m.filterInput.Value()
+				return m, func() tea.Msg { return filterMsg{value} }
+			case "esc":
+				m.filtering = false
+				m.filterInput.Blur()
+				m.filterInput.SetValue(m.filter)
+				m.runningTable.Focus()
+				return m, nil
+			case "ctrl+c":
+				return m, tea.Quit
+			}
+			var cmd tea.Cmd
+			m.filterInput, cmd = m.filterInput.Update(msg)
+			return m, cmd
+		}
+
 		switch keypress := msg.String(); keypress {
 		case "q", "ctrl+c":
 			return m, tea.Quit
+		case "/":
+			m.filtering = true
+			m.runningTable.Blur()
+			return m, m.filterInput.Focus()
 		case "enter":
-			m.selectedMachine = &m.machines[m.runningTable.Cursor()]
+			if len(m.visibleMachines) == 0 {
+				return m, nil
+			}
+			m.selectedMachine = &m.visibleMachines[m.runningTable.Cursor()]
 			m.currentState = detailState
 			return m, m.startTimer(m.errorTimeout, timerMsg{})
 		case "tab":
@@ -211,10 +310,35 @@ func (m Model) updateDetailState(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
 	case timerMsg:
 		return m, m.startTimer(m.errorTimeout, timerMsg{})
+	case restartMsg:
+		for _, instance := range msg.instances {
+			if instance.ID == m.selectedMachine.ID {
+				updated := instance
+				m.selectedMachine = &updated
+			}
+		}
+		return m, nil
 	case tea.KeyMsg:
+		// Restart prompt swallows keys until answered
+		if m.confirmRestart {
+			switch msg.String() {
+			case "y", "Y":
+				m.confirmRestart = false
+				return m, m.restartCmd(m.selectedMachine.ID)
+			case "ctrl+c":
+				return m, tea.Quit
+			default:
+				m.confirmRestart = false
+			}
+			return m, nil
+		}
+
 		switch keypress := msg.String(); keypress {
 		case "q", "ctrl+c":
 			return m, tea.Quit
+		case "r":
+			m.confirmRestart = true
+			return m, nil
 		case "esc":
 			m.currentState = runningState
 			m.runningTable.Focus()
@@ -223,13 +347,15 @@ func (m Model) updateDetailState(msg tea.Msg) (tea.Model, tea.Cmd) {
 				m.startTimer(m.refreshInterval, timerMsg{}),
 			)
 		case "s":
+			// Released IPs get reused, drop the host keys recorded for them
+			if _, err := sshlib.PruneKnownHosts(api.ReleasedIPs(m.machines)); err != nil {
+				return m, func() tea.Msg { return errMsg{err} }
+			}
 			return m, tea.Exec(
 				&sshlib.SSHExecCommand{
 					Target: sshlib.SSHTarget{
-						Host:    m.selectedMachine.IP,
-						KeyName: "id_aap",
-						Port:    22,
-						User:    "ubuntu",
+						Host:     m.selectedMachine.IP,
+						KeyFiles: legacyKeyFiles(),
 					},
 				}, func(err error) tea.Msg { return errMsg{err} },
 			)
@@ -289,9 +415,19 @@ func (m Model) View() string {
 func runningView(m Model) string {
 	var b strings.Builder
 
-	b.WriteString("VM List\n\n")
+	b.WriteString("VM List")
+	if m.filter != "" {
+		b.WriteString(fmt.Sprintf(" (%d of %d, filter: %s)", len(m.visibleMachines), len(m.machines), m.filter))
+	}
+	b.WriteString("\n\n")
 	b.WriteString(borderStyle.Render(m.runningTable.View()))
-	b.WriteString("\n\n(q) Quit (enter) View Details (tab) Launch Options")
+	if m.filtering {
+		b.WriteString("\n\n" + m.filterInput.View())
+	}
+	if m.progress != "" {
+		b.WriteString("\n\n" + m.progress)
+	}
+	b.WriteString("\n\n(q) Quit (enter) View Details (tab) Launch Options (/) Filter")
 	return b.String()
 }
 
@@ -310,7 +446,11 @@ func detailView(m Model) string {
 
 	b.WriteString("VM Details\n\n")
 	b.WriteString(borderStyle.Render(utils.PrettyYAML(m.selectedMachine)))
-	b.WriteString("\n\n(q) Quit (esc) Back (s) SSH")
+	if m.confirmRestart {
+		b.WriteString(fmt.Sprintf("\n\nRestart %s (%s)? (y) Yes (any other key) No", m.selectedMachine.Name, m.selectedMachine.ID))
+	} else {
+		b.WriteString("\n\n(q) Quit (esc) Back (s) SSH (r) Restart")
+	}
 
 	return b.String()
 }
@@ -327,25 +467,79 @@ func launchView(m Model) string {
 
 func (m Model) launchCmd() tea.Cmd {
 	return func() tea.Msg {
-		_, err := m.client.LaunchInstances(*m.selectedOption, 1)
+		launched, err := m.client.LaunchInstances(m.ctx, *m.selectedOption, api.LaunchOptions{Quantity: 1})
 		if err != nil {
 			return errMsg{err}
 		}
-		return m.refreshInstances()
+		return launchedMsg{launched.InstanceIDs}
 	}
 }
 
-// func (m Model) applyFilter() tea.Cmd {
-// 	return func() tea.Msg {
-// 		filtered, err := m.client.ListInstances()
-// 		if err != nil {
-// 			return errMsg{err}
-// 		}
-// 		m.machines = filtered
-// 		m.table.SetRows(machineSliceToTableRows(m.machines))
-// 		return nil
-// 	}
-// }
+// Wait for launched instances in the background, feeding progress into ch
+func (m Model) waitCmd(ids []string, ch chan tea.Msg) tea.Cmd {
+	return func() tea.Msg {
+		ctx, cancel := context.WithTimeout(m.ctx, m.waitTimeout)
+		defer cancel()
+
+		_, err := m.client.WaitForInstances(ctx, ids, api.WaitOptions{
+			Progress: func(event api.WaitEvent) {
+				select {
+				case ch <- progressMsg{event, ch}:
+				case <-ctx.Done():
+				}
+			},
+		})
+		if errors.Is(err, context.DeadlineExceeded) {
+			err = fmt.Errorf("instances not active after %s", m.waitTimeout)
+		}
+		close(ch)
+		return waitDoneMsg{err}
+	}
+}
+
+// Next progress update, or nothing once the wait is over
+func nextProgress(ch <-chan tea.Msg) tea.Cmd {
+	if ch == nil {
+		return nil
+	}
+	return func() tea.Msg {
+		msg, ok := <-ch
+		if !ok {
+			return nil
+		}
+		return msg
+	}
+}
+
+// The TUI's key before ssh-key-file existed, still tried when it's there
+const legacyKeyName = "id_aap"
+
+func legacyKeyFiles() []string {
+	keyFile, err := sshlib.KeyPath(legacyKeyName)
+	if err != nil {
+		return nil
+	}
+	if _, err := os.Stat(keyFile); err != nil {
+		return nil
+	}
+	return []string{keyFile}
+}
+
+func (m Model) restartCmd(id string) tea.Cmd {
+	return func() tea.Msg {
+		instances, err := m.client.RestartInstances(m.ctx, []string{id})
+		if err != nil {
+			return errMsg{err}
+		}
+		return restartMsg{instances}
+	}
+}
+
+// Narrow the machine list to the current filter and refresh the table
+func (m *Model) applyFilter() {
+	m.visibleMachines = filter.Apply(m.instanceFilter, m.machines)
+	m.runningTable.SetRows(machineSliceToTableRows(m.visibleMachines))
+}
 
 func machineSliceToTableRows(machines []api.InstanceDetails) []table.Row {
 	// Sort the slice before transforming into table rows
@@ -374,6 +568,7 @@ func machineSliceToTableRows(machines []api.InstanceDetails) []table.Row {
 			fmt.Sprintf("%d GiB", machine.InstanceType.Specs.MemoryGiB),
 			fmt.Sprintf("%d GiB", machine.InstanceType.Specs.StorageGiB),
 			machine.Status,
+			tags.Format(machine.Tags),
 		}
 	}
 
@@ -409,9 +604,18 @@ func optionSliceToTableRows(options []api.InstanceOption) []table.Row {
 	return rows
 }
 
-func Start() error {
-	program := tea.NewProgram(NewModel(), tea.WithAltScreen())
-	_, err := program.Run()
+func Start(ctx context.Context, filterExpr string) error {
+	// In-flight requests are cancelled once the program exits
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	model, err := NewModel(ctx, filterExpr)
+	if err != nil {
+		return err
+	}
+
+	program := tea.NewProgram(model, tea.WithAltScreen(), tea.WithContext(ctx))
+	_, err = program.Run()
 	if err != nil {
 		return fmt.Errorf("error running program: %v", err)
 	}